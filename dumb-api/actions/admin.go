@@ -0,0 +1,33 @@
+package actions
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"dumb-api/config"
+	"dumb-api/internal/services"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// ReloadConfig reloads evm_config.json and reconciles the graph with it.
+// Requests must carry the ADMIN_TOKEN in the X-Admin-Token header.
+func ReloadConfig(c buffalo.Context) error {
+	token := c.Request().Header.Get("X-Admin-Token")
+	if config.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+		return c.Error(http.StatusForbidden, errors.New("forbidden"))
+	}
+
+	watcher := services.GetConfigWatcher()
+	if watcher == nil {
+		return c.Error(http.StatusServiceUnavailable, errors.New("config watcher not running"))
+	}
+
+	summary, err := watcher.Reload(c)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(summary))
+}
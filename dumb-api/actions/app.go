@@ -44,7 +44,20 @@ func App() *AppContext {
 
 		appInstance.GET("/api/v1/prices", GetPriceData)
 		appInstance.POST("/api/v1/path", FindBestPath)
+		appInstance.POST("/api/v1/path/stream", StreamBestPath)
 		appInstance.GET("/api/v1/tokens", GetTokens)
+		appInstance.GET("/api/v1/tokens/prices", GetTokenPrices)
+		appInstance.GET("/api/v1/tokens/{address}/price", GetTokenPrice)
+		appInstance.GET("/api/v1/tokens/{address}/tvl", GetTokenTVL)
+		appInstance.GET("/api/v1/pools", GetPools)
+		appInstance.GET("/api/v1/pools/{address}", GetPool)
+		appInstance.GET("/api/v1/pools/{address}/twap", GetPoolTWAP)
+		appInstance.GET("/api/v1/pools/{address}/liquidity", GetPoolLiquidity)
+		appInstance.GET("/api/v1/volume/pools/{address}", GetPoolVolume)
+		appInstance.GET("/api/v1/volume/tokens/{address}", GetTokenVolume)
+		appInstance.GET("/api/v1/volume/chains/{chain}", GetChainVolume)
+		appInstance.GET("/api/v1/status", GetListenerStatus)
+		appInstance.POST("/api/v1/admin/reload-config", ReloadConfig)
 	}
 	return appInstance
 }
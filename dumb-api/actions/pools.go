@@ -0,0 +1,203 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dumb-api/internal/catalog"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/tvl"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+)
+
+const (
+	// defaultPoolsLimit and maxPoolsLimit bound a page of pools.
+	defaultPoolsLimit = 100
+	maxPoolsLimit     = 1000
+
+	// defaultLiquidityRange is how far from the current price, in percent,
+	// the tick ranges of a liquidity chart go by default.
+	defaultLiquidityRange = 50
+)
+
+// defaultDepths are the price moves, in percent, the depth of a liquidity
+// chart is reported for by default.
+var defaultDepths = []float64{1, 2, 5, 10, 25}
+
+// PoolsResponse is a page of pools along with the TVL of each chain,
+// bridges included.
+type PoolsResponse struct {
+	Chains []tvl.ChainTVL `json:"chains"`
+	Pools  []catalog.Pool `json:"pools"`
+	Total  int            `json:"total"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+// GetPools lists pools by TVL, largest first unless order is asc. They can be
+// filtered by chain, token, dex type and status (active or retired), and are
+// paginated with limit and offset.
+func GetPools(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+
+	chain, err := chainParam(c)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+	filter := catalog.Filter{
+		Chain:  chain,
+		Dex:    c.Param("dex"),
+		Status: c.Param("status"),
+		Limit:  defaultPoolsLimit,
+	}
+
+	if token := c.Param("token"); token != "" {
+		if !common.IsHexAddress(token) {
+			return c.Error(http.StatusBadRequest, errors.New("invalid token address"))
+		}
+		filter.Token = common.HexToAddress(token).Hex()
+	}
+	switch filter.Status {
+	case "", "active", "retired":
+	default:
+		return c.Error(http.StatusBadRequest, errors.New("invalid status"))
+	}
+	switch c.Param("order") {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return c.Error(http.StatusBadRequest, errors.New("invalid order"))
+	}
+	if param := c.Param("limit"); param != "" {
+		if filter.Limit, err = strconv.Atoi(param); err != nil || filter.Limit <= 0 {
+			return c.Error(http.StatusBadRequest, errors.New("invalid limit"))
+		}
+		filter.Limit = min(filter.Limit, maxPoolsLimit)
+	}
+	if param := c.Param("offset"); param != "" {
+		if filter.Offset, err = strconv.Atoi(param); err != nil || filter.Offset < 0 {
+			return c.Error(http.StatusBadRequest, errors.New("invalid offset"))
+		}
+	}
+
+	g := graph.GetGlobalGraph()
+	if g == nil {
+		return c.Error(http.StatusServiceUnavailable, errors.New("graph not initialized"))
+	}
+	pools, total, err := catalog.List(tx, g, filter)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	chains, err := tvl.Chains(tx)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	if chain != "" {
+		filtered := chains[:0]
+		for _, chainTVL := range chains {
+			if chainTVL.Chain == chain {
+				filtered = append(filtered, chainTVL)
+			}
+		}
+		chains = filtered
+	}
+
+	return c.Render(http.StatusOK, r.JSON(PoolsResponse{
+		Chains: chains,
+		Pools:  pools,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}))
+}
+
+// GetPool describes a pool: its tokens, DEX, fee, status and TVL and, when
+// the graph routes through it, its state, spot prices and last update block.
+// The chain parameter picks the pool when the address exists on several.
+func GetPool(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	if !common.IsHexAddress(c.Param("address")) {
+		return c.Error(http.StatusBadRequest, errors.New("invalid pool address"))
+	}
+
+	chain, err := chainParam(c)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	g := graph.GetGlobalGraph()
+	if g == nil {
+		return c.Error(http.StatusServiceUnavailable, errors.New("graph not initialized"))
+	}
+	pool, err := catalog.Get(tx, g, chain, common.HexToAddress(c.Param("address")).Hex())
+	if errors.Is(err, catalog.ErrNotFound) {
+		return c.Error(http.StatusNotFound, err)
+	}
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return c.Render(http.StatusOK, r.JSON(pool))
+}
+
+// GetPoolLiquidity charts the liquidity of a concentrated liquidity pool: the
+// liquidity active in each tick range within range percent of the current
+// price (50 by default), with the token amounts the ranges hold, and the
+// amounts bought by moving the price by each of depths, a comma separated
+// list of percentages (1,2,5,10,25 by default).
+func GetPoolLiquidity(c buffalo.Context) error {
+	if !common.IsHexAddress(c.Param("address")) {
+		return c.Error(http.StatusBadRequest, errors.New("invalid pool address"))
+	}
+
+	chain, err := chainParam(c)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	window := float64(defaultLiquidityRange)
+	if param := c.Param("range"); param != "" {
+		if window, err = strconv.ParseFloat(param, 64); err != nil || window <= 0 || window > 1000 {
+			return c.Error(http.StatusBadRequest, errors.New("invalid range"))
+		}
+	}
+
+	depths := defaultDepths
+	if param := c.Param("depths"); param != "" {
+		depths = nil
+		for _, value := range strings.Split(param, ",") {
+			depth, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || depth <= 0 || depth >= 100 {
+				return c.Error(http.StatusBadRequest, errors.New("invalid depths"))
+			}
+			depths = append(depths, depth)
+		}
+	}
+	levels := make([]float64, len(depths))
+	for i, depth := range depths {
+		levels[i] = depth / 100
+	}
+
+	g := graph.GetGlobalGraph()
+	if g == nil {
+		return c.Error(http.StatusServiceUnavailable, errors.New("graph not initialized"))
+	}
+	chart, err := catalog.Liquidity(g, chain, c.Param("address"), window/100, levels)
+	switch {
+	case errors.Is(err, catalog.ErrNotFound):
+		return c.Error(http.StatusNotFound, errors.New("pool not tracked"))
+	case errors.Is(err, catalog.ErrNoTickLiquidity):
+		return c.Error(http.StatusBadRequest, err)
+	case errors.Is(err, catalog.ErrUnknownDecimals):
+		return c.Error(http.StatusServiceUnavailable, err)
+	case err != nil:
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return c.Render(http.StatusOK, r.JSON(chart))
+}
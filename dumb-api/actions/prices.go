@@ -3,20 +3,34 @@ package actions
 import (
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
-	"dumb-api/models"
+	"dumb-api/internal/candles"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/pop/v6"
 )
 
+const (
+	// maxCandles is how many of the latest candles are returned per interval
+	// when no interval is requested.
+	maxCandles = 365
+
+	// defaultSeriesLimit and maxSeriesLimit bound the candles of a series.
+	defaultSeriesLimit = 300
+	maxSeriesLimit     = 5000
+)
+
 type Candlestick struct {
-	Open  float64
-	Close float64
-	High  float64
-	Low   float64
-	Time  time.Time
+	Open       float64
+	Close      float64
+	High       float64
+	Low        float64
+	Volume     float64
+	TradeCount int
+	Time       time.Time
 }
 
 type Candlesticks struct {
@@ -26,44 +40,66 @@ type Candlesticks struct {
 	OneDay      []Candlestick
 }
 
-type Group struct {
-	Time  time.Time
-	Ticks []models.PriceTick
+// PriceSeries is one interval of candles for a pair, in the shape charting
+// libraries expect.
+type PriceSeries struct {
+	TokenIn  string `json:"tokenIn"`
+	TokenOut string `json:"tokenOut"`
+	Chain    string `json:"chain,omitempty"`
+	Pool     string `json:"pool,omitempty"`
+	Interval string `json:"interval"`
+	// Inverted is set when the candles were derived from the ticks of the
+	// reverse pair.
+	Inverted bool          `json:"inverted"`
+	Candles  []PriceCandle `json:"candles"`
 }
 
-func GetPriceData(c buffalo.Context) error {
-
-	tokenIn := c.Param("tokenIn")
-	tokenOut := c.Param("tokenOut")
+// PriceCandle is a candle with its bucket start as a Unix timestamp.
+type PriceCandle struct {
+	Time   int64   `json:"time"`
+	Open   float64 `json:"open"`
+	High   float64 `json:"high"`
+	Low    float64 `json:"low"`
+	Close  float64 `json:"close"`
+	Volume float64 `json:"volume"`
+	Trades int     `json:"trades"`
+}
 
-	var candlesticks Candlesticks
+// GetPriceData returns the candles of the pair tokenIn/tokenOut. With an
+// interval parameter it returns a single gap-filled series, narrowed by the
+// from, to, limit, chain and pool parameters. Without one it returns the
+// latest candles of every interval across all pools and chains.
+func GetPriceData(c buffalo.Context) error {
+	tokenIn := common.HexToAddress(c.Param("tokenIn")).Hex()
+	tokenOut := common.HexToAddress(c.Param("tokenOut")).Hex()
 
 	tx := c.Value("tx").(*pop.Connection)
-	var results []models.PriceTick
-	query := tx.Where("token_in = ? AND token_out = ?", tokenIn, tokenOut).Order("created_at asc")
-	err := query.All(&results)
-	if err != nil {
-		return c.Error(http.StatusInternalServerError, err)
-	}
-	candlesticks, err = generateAllCandlesticks(results)
-	if err != nil {
-		return c.Error(http.StatusInternalServerError, err)
-	}
-
-	return c.Render(http.StatusOK, r.JSON(candlesticks))
 
-}
+	if c.Param("interval") != "" {
+		return getPriceSeries(c, tx, tokenIn, tokenOut)
+	}
 
-func generateAllCandlesticks(results []models.PriceTick) (Candlesticks, error) {
 	var candlesticks Candlesticks
-
-	ticks := []string{"1m", "5m", "1h", "1d"}
-	for _, tick := range ticks {
-		cs, err := generateCandlesticks(results, tick)
+	for _, interval := range candles.Intervals {
+		rows, err := candles.Latest(tx, interval, "", candles.AllPools, tokenIn, tokenOut, maxCandles)
 		if err != nil {
-			return Candlesticks{}, err
+			return c.Error(http.StatusInternalServerError, err)
 		}
-		switch tick {
+
+		cs := make([]Candlestick, len(rows))
+		for i, row := range rows {
+			cs[i] = Candlestick{
+				Open:       row.Open,
+				Close:      row.Close,
+				High:       row.High,
+				Low:        row.Low,
+				Volume:     row.Volume,
+				TradeCount: row.TradeCount,
+				Time:       row.Bucket,
+			}
+		}
+
+		switch interval.Name {
 		case "1m":
 			candlesticks.OneMinute = cs
 		case "5m":
@@ -75,78 +111,108 @@ func generateAllCandlesticks(results []models.PriceTick) (Candlesticks, error) {
 		}
 	}
 
-	return candlesticks, nil
+	return c.Render(http.StatusOK, r.JSON(candlesticks))
 }
 
-func generateCandlesticks(results []models.PriceTick, tick string) ([]Candlestick, error) {
-	var candlesticks []Candlestick
+func getPriceSeries(c buffalo.Context, tx *pop.Connection, tokenIn, tokenOut string) error {
+	interval, ok := candles.IntervalByName(c.Param("interval"))
+	if !ok {
+		return c.Error(http.StatusBadRequest, errors.New("unknown interval"))
+	}
 
-	tickDurations := map[string]time.Duration{
-		"1m": 1 * time.Minute,
-		"5m": 5 * time.Minute,
-		"1h": 1 * time.Hour,
-		"1d": 24 * time.Hour,
+	limit := defaultSeriesLimit
+	if param := c.Param("limit"); param != "" {
+		var err error
+		if limit, err = strconv.Atoi(param); err != nil || limit <= 0 {
+			return c.Error(http.StatusBadRequest, errors.New("invalid limit"))
+		}
+		limit = min(limit, maxSeriesLimit)
 	}
 
-	tickDuration, ok := tickDurations[tick]
-	if !ok {
-		return nil, errors.New("invalid tick")
+	to := time.Now()
+	if param := c.Param("to"); param != "" {
+		var err error
+		if to, err = parseTime(param); err != nil {
+			return c.Error(http.StatusBadRequest, errors.New("invalid to"))
+		}
+	}
+	to = interval.Bucket(to)
+
+	// The range is trimmed to the latest limit buckets.
+	earliest := to.Add(-time.Duration(limit-1) * interval.Duration)
+	from := earliest
+	if param := c.Param("from"); param != "" {
+		var err error
+		if from, err = parseTime(param); err != nil {
+			return c.Error(http.StatusBadRequest, errors.New("invalid from"))
+		}
+		if from.Before(earliest) {
+			from = earliest
+		}
+	}
+	if from.After(to) {
+		return c.Error(http.StatusBadRequest, errors.New("from is after to"))
 	}
 
-	var groups []Group
-	var currentGroup Group
+	chain, err := chainParam(c)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
 
-	for _, result := range results {
-		groupTime := result.CreatedAt.Truncate(tickDuration)
-		if currentGroup.Time != groupTime {
-			if currentGroup.Time != (time.Time{}) {
-				groups = append(groups, currentGroup)
-			}
-			currentGroup = Group{
-				Time:  groupTime,
-				Ticks: []models.PriceTick{result},
-			}
-		} else {
-			currentGroup.Ticks = append(currentGroup.Ticks, result)
-		}
+	pool := candles.AllPools
+	if param := c.Param("pool"); param != "" {
+		pool = common.HexToAddress(param).Hex()
 	}
 
-	if len(currentGroup.Ticks) > 0 {
-		groups = append(groups, currentGroup)
+	series := PriceSeries{
+		TokenIn:  tokenIn,
+		TokenOut: tokenOut,
+		Chain:    chain,
+		Pool:     pool,
+		Interval: interval.Name,
 	}
 
-	start := len(groups) - 365
-	if start < 0 {
-		start = 0
+	rows, previous, err := candles.Range(tx, interval, chain, pool, tokenIn, tokenOut, from, to)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
 	}
 
-	for j, group := range groups[start:] {
-		var open, close, high, low float64
-		for i, result := range group.Ticks {
-			price := result.Price
-			if i == 0 {
-				if j == 0 {
-					open = price
-				} else {
-					open = candlesticks[len(candlesticks)-1].Close
-				}
-			}
-			if i == len(group.Ticks)-1 {
-				close = price
-			}
-			if price > high || i == 0 {
-				high = price
-			}
-			if price < low || i == 0 {
-				low = price
-			}
+	if len(rows) == 0 && previous == nil {
+		rows, previous, err = candles.Range(tx, interval, chain, pool, tokenOut, tokenIn, from, to)
+		if err != nil {
+			return c.Error(http.StatusInternalServerError, err)
 		}
-		candlesticks = append(candlesticks, Candlestick{Open: open, Close: close, High: high, Low: low, Time: group.Time})
+		for i := range rows {
+			rows[i] = candles.Invert(rows[i])
+		}
+		if previous != nil {
+			inverted := candles.Invert(*previous)
+			previous = &inverted
+		}
+		series.Inverted = len(rows) > 0 || previous != nil
 	}
 
-	if candlesticks == nil {
-		candlesticks = []Candlestick{}
+	filled := candles.Fill(interval, rows, previous, from, to)
+	series.Candles = make([]PriceCandle, len(filled))
+	for i, candle := range filled {
+		series.Candles[i] = PriceCandle{
+			Time:   candle.Bucket.Unix(),
+			Open:   candle.Open,
+			High:   candle.High,
+			Low:    candle.Low,
+			Close:  candle.Close,
+			Volume: candle.Volume,
+			Trades: candle.TradeCount,
+		}
 	}
 
-	return candlesticks, nil
+	return c.Render(http.StatusOK, r.JSON(series))
+}
+
+// parseTime accepts Unix timestamps in seconds and RFC 3339 times.
+func parseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
 }
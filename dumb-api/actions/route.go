@@ -3,11 +3,18 @@ package actions
 import (
 	"errors"
 	"math/big"
+	"strconv"
+	"strings"
+	"time"
 
+	"dumb-api/config"
 	"dumb-api/internal/graph"
+	"dumb-api/internal/history"
+	"dumb-api/models"
 
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/buffalo/render"
+	"github.com/gobuffalo/pop/v6"
 )
 
 // PathRequest represents the incoming request structure
@@ -15,6 +22,18 @@ type PathRequest struct {
 	TokenA  string `json:"tokenA"`
 	AmountA string `json:"amountA"`
 	TokenB  string `json:"tokenB"`
+	ChainA  string `json:"chainA"`
+	// View selects the pool state to quote against: "latest" (default) or
+	// "finalized", which only reflects blocks with enough confirmations.
+	View string `json:"view"`
+	// BlockNumber or Timestamp, when set, quote against the state pools had
+	// once that block was applied, or at that time, as recorded in the pool
+	// state history. They cannot be combined with View.
+	BlockNumber *int64     `json:"blockNumber"`
+	Timestamp   *time.Time `json:"timestamp"`
+	// DebounceMs is the least time between two quotes of a stream, in
+	// milliseconds.
+	DebounceMs int `json:"debounceMs"`
 }
 
 // PathResponse represents the response structure
@@ -22,43 +41,135 @@ type PathResponse struct {
 	Path      []graph.Path `json:"path"`
 	AmountIn  string       `json:"amountIn"`
 	AmountOut string       `json:"amountOut"`
-	Success   bool         `json:"success"`
-	Error     string       `json:"error,omitempty"`
+	View      string       `json:"view"`
+	// BlockNumber is the block a historical or streamed quote was computed
+	// at.
+	BlockNumber int64  `json:"blockNumber,omitempty"`
+	Success     bool   `json:"success"`
+	Error       string `json:"error,omitempty"`
 }
 
 func FindBestPath(c buffalo.Context) error {
+	req, amountIn, chainConfig, err := bindPathRequest(c)
+	if err != nil {
+		return err
+	}
+
+	var g *graph.Graph
+	var block int64
+	switch {
+	case req.BlockNumber != nil || req.Timestamp != nil:
+		if req.View != "" {
+			return c.Error(400, errors.New("view cannot be combined with blockNumber or timestamp"))
+		}
+		req.View = "historical"
+		chainID := strconv.Itoa(chainConfig.ChainId)
+		if g, block, err = historicalGraph(c, strings.ToLower(req.ChainA), chainID, req.BlockNumber, req.Timestamp); err != nil {
+			return err
+		}
+	case req.View == "" || req.View == "latest":
+		req.View = "latest"
+		g = graph.GetGlobalGraph()
+	case req.View == "finalized":
+		g = graph.GetFinalizedGraph()
+	default:
+		return c.Error(400, errors.New("unknown view"))
+	}
+
+	updateThreshold := new(big.Float).SetFloat64(0.01)
+
+	// Lock the graph
+	paths := g.GetBestPaths(req.TokenA, req.TokenB, strings.ToLower(req.ChainA), amountIn, updateThreshold)
+
+	return c.Render(200, render.JSON(newPathResponse(req, paths, block)))
+}
+
+func newPathResponse(req PathRequest, paths []graph.Path, block int64) PathResponse {
+	response := PathResponse{
+		Path:        paths,
+		AmountIn:    req.AmountA,
+		View:        req.View,
+		BlockNumber: block,
+		Success:     len(paths) > 0,
+	}
+
+	if len(paths) > 0 {
+		response.AmountOut = paths[len(paths)-1].AmountOut.String()
+	} else {
+		response.Error = "no valid path found"
+	}
+
+	return response
+}
+
+// bindPathRequest binds and validates a path request, defaulting its chain to
+// avalanche, and returns the amount to quote and the chain's configuration.
+func bindPathRequest(c buffalo.Context) (PathRequest, *big.Int, config.ChainConfig, error) {
 	var req PathRequest
 	if err := c.Bind(&req); err != nil {
-		return c.Error(400, err)
+		return req, nil, config.ChainConfig{}, c.Error(400, err)
 	}
 
 	amountIn := new(big.Int)
 	if _, success := amountIn.SetString(req.AmountA, 10); !success {
-		return c.Error(400, errors.New("invalid amount format"))
+		return req, nil, config.ChainConfig{}, c.Error(400, errors.New("invalid amount format"))
 	}
 
 	if req.TokenA == "" || req.TokenB == "" {
-		return c.Error(400, errors.New("invalid token addresses"))
+		return req, nil, config.ChainConfig{}, c.Error(400, errors.New("invalid token addresses"))
 	}
 
-	updateThreshold := new(big.Float).SetFloat64(0.01)
+	if req.ChainA == "" {
+		req.ChainA = "avalanche"
+	}
 
-	// Use the global graph
-	g := graph.GetGlobalGraph()
-	// Lock the graph
-	paths := g.GetBestPaths(req.TokenA, req.TokenB, amountIn, updateThreshold)
+	chainConfig, ok := config.GetChainConfig(req.ChainA)
+	if !ok {
+		return req, nil, config.ChainConfig{}, c.Error(400, errors.New("unknown chain"))
+	}
 
-	response := PathResponse{
-		Path:     paths,
-		AmountIn: req.AmountA,
-		Success:  len(paths) > 0,
+	return req, amountIn, chainConfig, nil
+}
+
+// historicalGraph rebuilds the pools of chain as of block, or as of the last
+// block recorded at or before timestamp when block is nil, together with the
+// pools of the other chains and the bridges between them at that time.
+// Blocks the listener has not applied yet are rejected, since their state is
+// unknown.
+func historicalGraph(c buffalo.Context, chain, chainID string, block *int64, timestamp *time.Time) (*graph.Graph, int64, error) {
+	tx := c.Value("tx").(*pop.Connection)
+
+	var chainState models.ChainState
+	if err := tx.Where("chain_id = ?", chainID).First(&chainState); err != nil {
+		return nil, 0, c.Error(503, errors.New("chain has not been indexed yet"))
 	}
 
-	if len(paths) > 0 {
-		response.AmountOut = paths[len(paths)-1].AmountOut.String()
+	var number int64
+	if block != nil {
+		number = *block
+		if number > chainState.LastBlock {
+			return nil, 0, c.Error(400, errors.New("block has not been indexed yet"))
+		}
 	} else {
-		response.Error = "no valid path found"
+		if timestamp.After(chainState.UpdatedAt) {
+			return nil, 0, c.Error(400, errors.New("timestamp has not been indexed yet"))
+		}
+		var err error
+		if number, err = history.BlockAt(tx, chain, *timestamp); err != nil {
+			return nil, 0, historyError(c, err)
+		}
 	}
 
-	return c.Render(200, render.JSON(response))
+	g, err := history.LoadAll(tx, chain, number)
+	if err != nil {
+		return nil, 0, historyError(c, err)
+	}
+	return g, number, nil
+}
+
+func historyError(c buffalo.Context, err error) error {
+	if errors.Is(err, history.ErrNoHistory) {
+		return c.Error(404, err)
+	}
+	return c.Error(500, err)
 }
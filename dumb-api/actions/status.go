@@ -0,0 +1,21 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+
+	"dumb-api/internal/services"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+// GetListenerStatus reports the progress of the block listener of every
+// chain run by this process.
+func GetListenerStatus(c buffalo.Context) error {
+	supervisor := services.GetSupervisor()
+	if supervisor == nil {
+		return c.Error(http.StatusServiceUnavailable, errors.New("listeners run in another process"))
+	}
+
+	return c.Render(http.StatusOK, r.JSON(supervisor.Statuses()))
+}
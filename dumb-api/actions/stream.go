@@ -0,0 +1,195 @@
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"dumb-api/config"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/streams"
+
+	"github.com/gobuffalo/buffalo"
+)
+
+const (
+	// defaultStreamDebounce, minStreamDebounce and maxStreamDebounce bound
+	// the time between two quotes of a stream.
+	defaultStreamDebounce = 500 * time.Millisecond
+	minStreamDebounce     = 100 * time.Millisecond
+	maxStreamDebounce     = time.Minute
+
+	// streamKeepAlive is how often an idle stream sends a comment, so
+	// proxies do not close it.
+	streamKeepAlive = 15 * time.Second
+)
+
+// StreamBestPath quotes a PathRequest as server-sent events. The first quote
+// is sent right away, then the route is quoted again whenever a pool on it,
+// or trading one of its tokens, changes, at most once per debounceMs (500 ms
+// by default). Quotes are only sent when they differ from the previous one.
+// Only the latest view can be streamed, and each client can hold
+// STREAM_SUBSCRIPTIONS_PER_CLIENT streams open.
+func StreamBestPath(c buffalo.Context) error {
+	req, amountIn, _, err := bindPathRequest(c)
+	if err != nil {
+		return err
+	}
+	if req.BlockNumber != nil || req.Timestamp != nil || (req.View != "" && req.View != "latest") {
+		return c.Error(http.StatusBadRequest, errors.New("only the latest view can be streamed"))
+	}
+	req.View = "latest"
+
+	debounce := defaultStreamDebounce
+	if req.DebounceMs != 0 {
+		debounce = time.Duration(req.DebounceMs) * time.Millisecond
+		if debounce < minStreamDebounce || debounce > maxStreamDebounce {
+			return c.Error(http.StatusBadRequest, errors.New("invalid debounceMs"))
+		}
+	}
+
+	g := graph.GetGlobalGraph()
+	if g == nil {
+		return c.Error(http.StatusServiceUnavailable, errors.New("graph not initialized"))
+	}
+	flusher, ok := c.Response().(http.Flusher)
+	if !ok {
+		return c.Error(http.StatusInternalServerError, errors.New("streaming not supported"))
+	}
+
+	sub, err := streams.Subscribe(clientAddress(c.Request()), config.StreamSubscriptionsPerClient)
+	if err != nil {
+		return c.Error(http.StatusTooManyRequests, err)
+	}
+	defer sub.Close()
+
+	w := c.Response()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	chain := strings.ToLower(req.ChainA)
+	quote := func() (PathResponse, map[string]bool) {
+		block := streams.Block(chain)
+		paths := g.GetBestPaths(req.TokenA, req.TokenB, chain, amountIn, new(big.Float).SetFloat64(0.01))
+		return newPathResponse(req, paths, block), watchedPools(g, req, paths)
+	}
+	send := func(response PathResponse) error {
+		data, err := json.Marshal(response)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: quote\ndata: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	last, watched := quote()
+	if err := send(last); err != nil {
+		return nil
+	}
+	sent := time.Now()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	var requote <-chan time.Time
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		case <-sub.C():
+			if requote != nil || !touches(sub.Take(), watched) {
+				continue
+			}
+			requote = time.After(max(debounce-time.Since(sent), 0))
+		case <-requote:
+			requote = nil
+			var next PathResponse
+			next, watched = quote()
+			if sameQuote(last, next) {
+				continue
+			}
+			if err := send(next); err != nil {
+				return nil
+			}
+			last, sent = next, time.Now()
+		}
+	}
+}
+
+// watchedPools returns the pools whose changes can alter the best route
+// from req.TokenA to req.TokenB: every pool trading a token of paths, or
+// trading either end of the route when there is none.
+func watchedPools(g *graph.Graph, req PathRequest, paths []graph.Path) map[string]bool {
+	tokens := []string{req.TokenA, req.TokenB}
+	for _, path := range paths {
+		tokens = append(tokens, path.TokenIn, path.TokenOut)
+	}
+
+	g.Mu.RLock()
+	defer g.Mu.RUnlock()
+
+	watched := make(map[string]bool)
+	for _, token := range tokens {
+		for _, pools := range g.Edges[token] {
+			for pool := range pools {
+				watched[pool] = true
+			}
+		}
+	}
+	return watched
+}
+
+// touches reports whether any of the changed pools is watched.
+func touches(changed, watched map[string]bool) bool {
+	for pool := range changed {
+		if watched[pool] {
+			return true
+		}
+	}
+	return false
+}
+
+// sameQuote reports whether a and b quote the same amount through the same
+// pools.
+func sameQuote(a, b PathResponse) bool {
+	if a.AmountOut != b.AmountOut || len(a.Path) != len(b.Path) {
+		return false
+	}
+	for i := range a.Path {
+		if a.Path[i].Pool != b.Path[i].Pool {
+			return false
+		}
+	}
+	return true
+}
+
+// clientAddress identifies the client of r for subscription limits: the
+// address the closest proxy put last in X-Forwarded-For, or the remote
+// address of the connection.
+func clientAddress(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		addresses := strings.Split(forwarded, ",")
+		return strings.TrimSpace(addresses[len(addresses)-1])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -1,10 +1,13 @@
 package actions
 
 import (
+	"errors"
 	"net/http"
 
+	"dumb-api/internal/pricing"
 	"dumb-api/models"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gobuffalo/buffalo"
 	"github.com/gobuffalo/buffalo/render"
 	"github.com/gobuffalo/pop/v6"
@@ -20,3 +23,45 @@ func GetTokens(c buffalo.Context) error {
 
 	return c.Render(http.StatusOK, render.JSON(tokens))
 }
+
+// GetTokenPrices lists the USD price of every token priced by this process,
+// optionally restricted to one chain.
+func GetTokenPrices(c buffalo.Context) error {
+	engine := pricing.GetEngine()
+	if engine == nil {
+		return c.Error(http.StatusServiceUnavailable, errors.New("pricing engine not running"))
+	}
+
+	chain, err := chainParam(c)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	return c.Render(http.StatusOK, r.JSON(engine.Prices(chain)))
+}
+
+// GetTokenPrice returns the USD price of a token on a chain, avalanche by
+// default.
+func GetTokenPrice(c buffalo.Context) error {
+	engine := pricing.GetEngine()
+	if engine == nil {
+		return c.Error(http.StatusServiceUnavailable, errors.New("pricing engine not running"))
+	}
+	if !common.IsHexAddress(c.Param("address")) {
+		return c.Error(http.StatusBadRequest, errors.New("invalid token address"))
+	}
+
+	chain, err := chainParam(c)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+	if chain == "" {
+		chain = "avalanche"
+	}
+
+	price, ok := engine.Price(chain, common.HexToAddress(c.Param("address")))
+	if !ok {
+		return c.Error(http.StatusNotFound, errors.New("token has no price"))
+	}
+	return c.Render(http.StatusOK, r.JSON(price))
+}
@@ -0,0 +1,87 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"dumb-api/config"
+	"dumb-api/internal/tvl"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+)
+
+// defaultTVLHistory is how far back the TVL history of a token goes when no
+// from is requested.
+const defaultTVLHistory = 7 * 24 * time.Hour
+
+// TokenTVLResponse is the amount of a token locked in pools and bridges,
+// now and hourly since From.
+type TokenTVLResponse struct {
+	Token   string         `json:"token"`
+	Chain   string         `json:"chain,omitempty"`
+	Amount  float64        `json:"amount"`
+	TVLUSD  float64        `json:"tvlUsd"`
+	Chains  []tvl.TokenTVL `json:"chains"`
+	From    time.Time      `json:"from"`
+	History []tvl.Point    `json:"history"`
+}
+
+// GetTokenTVL reports the amount of a token locked in pools and bridges per
+// chain, and its hourly history since from (a week by default).
+func GetTokenTVL(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	if !common.IsHexAddress(c.Param("address")) {
+		return c.Error(http.StatusBadRequest, errors.New("invalid token address"))
+	}
+	token := common.HexToAddress(c.Param("address")).Hex()
+
+	chain, err := chainParam(c)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	from := time.Now().Add(-defaultTVLHistory)
+	if param := c.Param("from"); param != "" {
+		if from, err = parseTime(param); err != nil {
+			return c.Error(http.StatusBadRequest, errors.New("invalid from"))
+		}
+	}
+
+	chains, err := tvl.Token(tx, chain, token)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	history, err := tvl.TokenHistory(tx, chain, token, from)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+
+	response := TokenTVLResponse{
+		Token:   token,
+		Chain:   chain,
+		Chains:  chains,
+		From:    from.UTC().Truncate(tvl.HistoryInterval),
+		History: history,
+	}
+	for _, total := range chains {
+		response.Amount += total.Amount
+		response.TVLUSD += total.TVLUSD
+	}
+	return c.Render(http.StatusOK, r.JSON(response))
+}
+
+// chainParam returns the lowercase chain query parameter, empty when absent,
+// or an error when it names an unknown chain.
+func chainParam(c buffalo.Context) (string, error) {
+	chain := strings.ToLower(c.Param("chain"))
+	if chain != "" {
+		if _, ok := config.GetChainConfig(chain); !ok {
+			return "", errors.New("unknown chain")
+		}
+	}
+	return chain, nil
+}
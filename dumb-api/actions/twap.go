@@ -0,0 +1,67 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dumb-api/internal/graph"
+	"dumb-api/internal/oracle"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+)
+
+const (
+	// defaultTWAPWindow and maxTWAPWindow bound the window of a TWAP.
+	defaultTWAPWindow = 30 * time.Minute
+	maxTWAPWindow     = 7 * 24 * time.Hour
+)
+
+// GetPoolTWAP returns the time-weighted average price of a tracked pool over
+// window, given in seconds or as a duration such as 30m (30 minutes by
+// default).
+func GetPoolTWAP(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	if !common.IsHexAddress(c.Param("address")) {
+		return c.Error(http.StatusBadRequest, errors.New("invalid pool address"))
+	}
+
+	window := defaultTWAPWindow
+	if param := c.Param("window"); param != "" {
+		var err error
+		if window, err = parseWindow(param); err != nil || window < time.Second || window > maxTWAPWindow {
+			return c.Error(http.StatusBadRequest, errors.New("invalid window"))
+		}
+	}
+
+	g := graph.GetGlobalGraph()
+	if g == nil {
+		return c.Error(http.StatusServiceUnavailable, errors.New("graph not initialized"))
+	}
+	g.Mu.RLock()
+	pool := g.GetPool(common.HexToAddress(c.Param("address")).Hex())
+	g.Mu.RUnlock()
+	if pool == nil {
+		return c.Error(http.StatusNotFound, errors.New("pool not tracked"))
+	}
+
+	twap, err := oracle.Compute(c, tx, pool, window)
+	if errors.Is(err, oracle.ErrNoData) {
+		return c.Error(http.StatusNotFound, err)
+	}
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return c.Render(http.StatusOK, r.JSON(twap))
+}
+
+// parseWindow parses a number of seconds or a duration.
+func parseWindow(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
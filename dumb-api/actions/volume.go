@@ -0,0 +1,76 @@
+package actions
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"dumb-api/config"
+	"dumb-api/internal/volume"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/pop/v6"
+)
+
+// VolumeResponse is the rolling volume of a pool, token or chain, keyed by
+// window name (1h, 24h and 7d).
+type VolumeResponse struct {
+	Pool    string                  `json:"pool,omitempty"`
+	Token   string                  `json:"token,omitempty"`
+	Chain   string                  `json:"chain,omitempty"`
+	Windows map[string]volume.Stats `json:"windows"`
+}
+
+// GetPoolVolume reports the volume and trade count of a pool, in USD and in
+// each of its tokens.
+func GetPoolVolume(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	if !common.IsHexAddress(c.Param("address")) {
+		return c.Error(http.StatusBadRequest, errors.New("invalid pool address"))
+	}
+	pool := common.HexToAddress(c.Param("address")).Hex()
+
+	windows, err := volume.PoolStats(tx, pool)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return c.Render(http.StatusOK, r.JSON(VolumeResponse{Pool: pool, Windows: windows}))
+}
+
+// GetTokenVolume reports the volume and trade count of every pool holding a
+// token, in USD and in the token, optionally restricted to one chain.
+func GetTokenVolume(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	if !common.IsHexAddress(c.Param("address")) {
+		return c.Error(http.StatusBadRequest, errors.New("invalid token address"))
+	}
+	token := common.HexToAddress(c.Param("address")).Hex()
+
+	chain, err := chainParam(c)
+	if err != nil {
+		return c.Error(http.StatusBadRequest, err)
+	}
+
+	windows, err := volume.TokenStats(tx, chain, token)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return c.Render(http.StatusOK, r.JSON(VolumeResponse{Token: token, Chain: chain, Windows: windows}))
+}
+
+// GetChainVolume reports the USD volume and trade count of every pool of a
+// chain.
+func GetChainVolume(c buffalo.Context) error {
+	tx := c.Value("tx").(*pop.Connection)
+	chain := strings.ToLower(c.Param("chain"))
+	if _, ok := config.GetChainConfig(chain); !ok {
+		return c.Error(http.StatusNotFound, errors.New("unknown chain"))
+	}
+
+	windows, err := volume.ChainStats(tx, chain)
+	if err != nil {
+		return c.Error(http.StatusInternalServerError, err)
+	}
+	return c.Render(http.StatusOK, r.JSON(VolumeResponse{Chain: chain, Windows: windows}))
+}
@@ -1,65 +1,70 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"dumb-api/actions"
 	"dumb-api/config"
-	"dumb-api/internal/dexes"
-	"dumb-api/internal/graph"
-	"dumb-api/internal/graph/edges"
-
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"dumb-api/internal/pricing"
+	"dumb-api/internal/retention"
+	"dumb-api/internal/rpcpool"
+	"dumb-api/internal/services"
+	"dumb-api/models"
 )
 
-func initializeGraph() {
-	globalGraph := graph.InitGlobalGraph()
+// initializeGraph bootstraps the graph and starts whatever keeps it up to
+// date, all of which stops when ctx is cancelled.
+func initializeGraph(ctx context.Context) (*rpcpool.Registry, error) {
+	// Updates published while the graph is bootstrapped are applied on top
+	// of it, so the cursor is read first.
+	var cursor int64
+	if config.ListenerMode == "subscribe" {
+		var err error
+		if cursor, err = services.PoolUpdateCursor(ctx, models.DB); err != nil {
+			return nil, err
+		}
+	}
 
-	client, err := ethclient.Dial(config.AVALANCHE_RPC_URL)
+	globalGraph, clients, err := services.BootstrapGraph(ctx)
 	if err != nil {
-		log.Fatalf("Failed to connect to %s network: %v", "AVALANCHE", err)
+		return nil, err
 	}
 
-	pools, v3Edges := dexes.InitUniswapV3(
-		client,
-		"avalanche",
-		config.EVMConfig["AVALANCHE"].UniswapV3.Factories,
-		config.TokensByChain["AVALANCHE"],
-		config.FeeTiers,
-	)
-
-	globalGraph.Mu.Lock()
-
-	for addr, pool := range pools {
-		globalGraph.NewPool(addr, pool.Token0, pool.Token1, pool.Factory)
+	watcher := services.InitConfigWatcher(config.EVMConfigPath, globalGraph, clients)
+	go watcher.Watch(ctx)
+
+	fallback := services.NewCoinGeckoService().GetTokenPrice
+	switch config.ListenerMode {
+	case "embedded":
+		services.InitSupervisor(models.DB, clients.Get, nil).Start(ctx)
+		services.NewTVLTracker(models.DB, clients.Get).Start(ctx)
+		pricing.InitEngine(models.DB, clients.Get, fallback).Start(ctx)
+		retention.Start(ctx, models.DB, config.Retention)
+	case "subscribe":
+		// Prices follow the replica's own graph, only the listener process
+		// persists them.
+		pricing.InitEngine(nil, clients.Get, fallback).Start(ctx)
+		go services.SubscribePoolUpdates(ctx, models.DB, globalGraph, cursor)
+	default:
+		log.Fatalf("Unknown LISTENER_MODE %q", config.ListenerMode)
 	}
 
-	globalGraph.Edges = v3Edges
-
-	createStaticPool(globalGraph)
-
-	globalGraph.Mu.Unlock()
-
+	return clients, nil
 }
 
-func createStaticPool(globalGraph *graph.Graph) {
-	usdcAvalanche := config.EVMConfig["AVALANCHE"].Tokens[0].Address
-	usdcCoq := config.EVMConfig["COQNET"].Tokens[0].Address
-
-	bridgeEdge01 := edges.BridgeEdge{
-		Token0: common.HexToAddress(usdcAvalanche),
-		Token1: common.HexToAddress(usdcCoq),
+// shutdown waits for the listeners to finish the block they are applying and
+// closes the RPC providers.
+func shutdown(clients *rpcpool.Registry) {
+	if supervisor := services.GetSupervisor(); supervisor != nil {
+		if !supervisor.Wait(services.ShutdownTimeout) {
+			log.Printf("Listeners did not stop within %s", services.ShutdownTimeout)
+		}
 	}
-
-	bridgeEdge10 := edges.BridgeEdge{
-		Token0: common.HexToAddress(usdcCoq),
-		Token1: common.HexToAddress(usdcAvalanche),
-	}
-
-	globalGraph.NewEdge(usdcAvalanche, usdcCoq, "pool", "coqnet", &bridgeEdge01)
-	globalGraph.NewEdge(usdcCoq, usdcAvalanche, "pool1", "avalanche", &bridgeEdge10)
-
+	clients.Close()
 }
 
 // main is the starting point for your Buffalo application.
@@ -69,10 +74,22 @@ func createStaticPool(globalGraph *graph.Graph) {
 // call `app.Serve()`, unless you don't want to start your
 // application that is. :)
 func main() {
-	initializeGraph()
+	// Buffalo drains in-flight requests on the same signals before Serve
+	// returns, the listeners are stopped through ctx.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	clients, err := initializeGraph(ctx)
+	if err != nil {
+		log.Printf("Stopped before the graph was loaded: %v", err)
+		return
+	}
 
 	app := actions.App()
-	if err := app.Serve(); err != nil {
+	err = app.Serve()
+	stop()
+	shutdown(clients)
+	if err != nil {
 		log.Fatal(err)
 	}
 }
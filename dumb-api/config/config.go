@@ -6,12 +6,13 @@ import (
 	"log"
 	"math/big"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
-	SyncTopic         string
-	SwapV3Topic       string
 	AmountIn          *big.Int
 	DefaultBuilderFee *big.Int
 	FeeTiers          []string
@@ -20,6 +21,23 @@ var (
 	SavePath          string
 	AVALANCHE_RPC_URL string
 	ENV               string
+	EVMConfigPath     string
+	AdminToken        string
+	ListenerMode      string
+
+	// Retention is how long rows of price_ticks, of each candle table and of
+	// pool_state_history are kept, zero keeping them forever. RETENTION
+	// overrides the defaults with comma separated table=duration pairs, such
+	// as price_ticks=14d.
+	Retention map[string]time.Duration
+
+	// StreamSubscriptionsPerClient caps the quote streams a client can hold
+	// open at once, set with STREAM_SUBSCRIPTIONS_PER_CLIENT.
+	StreamSubscriptionsPerClient int
+
+	// EVMConfigMu guards EVMConfig and TokensByChain, which can be swapped at
+	// runtime when evm_config.json is reloaded.
+	EVMConfigMu sync.RWMutex
 )
 
 type TokenConfig struct {
@@ -31,14 +49,44 @@ type TokenConfig struct {
 }
 
 type DexConfig struct {
+	Type      string   `json:"type"`
 	Factories []string `json:"factories"`
+	FeeTiers  []string `json:"feeTiers,omitempty"`
 }
 
 type ChainConfig struct {
 	UniswapV2 DexConfig     `json:"UniswapV2"`
 	UniswapV3 DexConfig     `json:"UniswapV3"`
+	Dexes     []DexConfig   `json:"dexes"`
 	Tokens    []TokenConfig `json:"tokens"`
 	ChainId   int           `json:"chainId"`
+	RpcUrl    string        `json:"rpcUrl"`
+	RpcUrls   []string      `json:"rpcUrls"`
+	RpcQuorum int           `json:"rpcQuorum"`
+	WsUrl     string        `json:"wsUrl"`
+	// Confirmations is how many blocks deep a block must be before it is
+	// considered final.
+	Confirmations int64 `json:"confirmations"`
+	// BlockTime is the average block interval in seconds, used to pace
+	// polling.
+	BlockTime float64 `json:"blockTime"`
+}
+
+// DexConfigs returns every DEX entry of the chain, including the legacy
+// UniswapV2 and UniswapV3 keys.
+func (c ChainConfig) DexConfigs() []DexConfig {
+	dexes := make([]DexConfig, 0, len(c.Dexes)+2)
+	if len(c.UniswapV2.Factories) > 0 {
+		legacy := c.UniswapV2
+		legacy.Type = "uniswapV2"
+		dexes = append(dexes, legacy)
+	}
+	if len(c.UniswapV3.Factories) > 0 {
+		legacy := c.UniswapV3
+		legacy.Type = "uniswapV3"
+		dexes = append(dexes, legacy)
+	}
+	return append(dexes, c.Dexes...)
 }
 
 func init() {
@@ -47,10 +95,21 @@ func init() {
 	TokensByChain = make(map[string][]string)
 	EVMConfig = make(map[string]ChainConfig)
 
-	SyncTopic = os.Getenv("SYNC_TOPIC")
-	SwapV3Topic = os.Getenv("SWAP_V3_TOPIC")
 	AVALANCHE_RPC_URL = os.Getenv("AVALANCHE_RPC_URL")
 	ENV = os.Getenv("ENV")
+	AdminToken = os.Getenv("ADMIN_TOKEN")
+
+	// "embedded" runs the chain listener inside the API process, "subscribe"
+	// applies the updates published by a standalone listener instead.
+	ListenerMode = os.Getenv("LISTENER_MODE")
+	if ListenerMode == "" {
+		ListenerMode = "embedded"
+	}
+
+	EVMConfigPath = os.Getenv("EVM_CONFIG_PATH")
+	if EVMConfigPath == "" {
+		EVMConfigPath = "evm_config.json"
+	}
 
 	AmountIn, err = loadBigInt("AMOUNT_IN")
 	if err != nil {
@@ -62,6 +121,19 @@ func init() {
 		log.Fatalf("failed to load DEFAULT_BUILDER_FEE: %v", err)
 	}
 
+	Retention, err = loadRetention()
+	if err != nil {
+		log.Fatalf("failed to load RETENTION: %v", err)
+	}
+
+	StreamSubscriptionsPerClient = 5
+	if value := os.Getenv("STREAM_SUBSCRIPTIONS_PER_CLIENT"); value != "" {
+		StreamSubscriptionsPerClient, err = strconv.Atoi(value)
+		if err != nil || StreamSubscriptionsPerClient < 1 {
+			log.Fatalf("invalid STREAM_SUBSCRIPTIONS_PER_CLIENT value: %s", value)
+		}
+	}
+
 	FeeTiers, err = loadFeeTiers()
 	if err != nil {
 		log.Fatalf("failed to load FEE_TIERS: %v", err)
@@ -86,6 +158,58 @@ func loadBigInt(envVar string) (*big.Int, error) {
 	return result, nil
 }
 
+func loadRetention() (map[string]time.Duration, error) {
+	retention := map[string]time.Duration{
+		"price_ticks": 7 * 24 * time.Hour,
+		"candles_1m":  90 * 24 * time.Hour,
+		"candles_5m":  180 * 24 * time.Hour,
+		"candles_1h":  0,
+		"candles_1d":  0,
+
+		"pool_state_history": 30 * 24 * time.Hour,
+	}
+
+	value := os.Getenv("RETENTION")
+	if value == "" {
+		return retention, nil
+	}
+	for _, policy := range strings.Split(value, ",") {
+		table, period, ok := strings.Cut(strings.TrimSpace(policy), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid policy %q, expected table=duration", policy)
+		}
+		if _, known := retention[table]; !known {
+			return nil, fmt.Errorf("unknown table %q", table)
+		}
+		d, err := parseRetention(period)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration for %s: %w", table, err)
+		}
+		retention[table] = d
+	}
+	return retention, nil
+}
+
+// parseRetention parses a duration, also accepting whole days such as 90d
+// and "forever" for zero.
+func parseRetention(value string) (time.Duration, error) {
+	if value == "forever" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
 func loadFeeTiers() ([]string, error) {
 	tiers := os.Getenv("FEE_TIERS")
 	if tiers == "" {
@@ -95,22 +219,90 @@ func loadFeeTiers() ([]string, error) {
 }
 
 func loadEVMConfig() error {
-	jsonData, err := os.ReadFile("evm_config.json")
+	evmConfig, err := ReadEVMConfig(EVMConfigPath)
+	if err != nil {
+		return err
+	}
+
+	SetEVMConfig(evmConfig)
+
+	return nil
+}
+
+// ReadEVMConfig parses the chain configuration at path without applying it.
+func ReadEVMConfig(path string) (map[string]ChainConfig, error) {
+	jsonData, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("error reading evm_config.json: %w", err)
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
 	}
 
-	if err := json.Unmarshal(jsonData, &EVMConfig); err != nil {
-		return fmt.Errorf("error parsing evm_config.json: %w", err)
+	evmConfig := make(map[string]ChainConfig)
+	if err := json.Unmarshal(jsonData, &evmConfig); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
 	}
 
-	for chain, chainConfig := range EVMConfig {
+	return evmConfig, nil
+}
+
+// SetEVMConfig replaces the active chain configuration and rebuilds TokensByChain.
+func SetEVMConfig(evmConfig map[string]ChainConfig) {
+	tokensByChain := make(map[string][]string)
+	for chain, chainConfig := range evmConfig {
 		addresses := make([]string, len(chainConfig.Tokens))
 		for i, token := range chainConfig.Tokens {
 			addresses[i] = token.Address
 		}
-		TokensByChain[chain] = addresses
+		tokensByChain[chain] = addresses
 	}
 
-	return nil
+	EVMConfigMu.Lock()
+	EVMConfig = evmConfig
+	TokensByChain = tokensByChain
+	EVMConfigMu.Unlock()
+}
+
+// GetEVMConfig returns the active chain configuration. The returned map must
+// not be modified.
+func GetEVMConfig() map[string]ChainConfig {
+	EVMConfigMu.RLock()
+	defer EVMConfigMu.RUnlock()
+	return EVMConfig
+}
+
+// RPCURLs returns the RPC endpoints of chain. The <CHAIN>_RPC_URL environment
+// variable, a comma separated list, takes precedence over the rpcUrl and
+// rpcUrls set in evm_config.json.
+func RPCURLs(chain string, chainConfig ChainConfig) []string {
+	var urls []string
+	if env := os.Getenv(strings.ToUpper(chain) + "_RPC_URL"); env != "" {
+		urls = strings.Split(env, ",")
+	} else {
+		urls = append([]string{chainConfig.RpcUrl}, chainConfig.RpcUrls...)
+	}
+
+	result := make([]string, 0, len(urls))
+	for _, url := range urls {
+		if url = strings.TrimSpace(url); url != "" {
+			result = append(result, url)
+		}
+	}
+	return result
+}
+
+// WSURL returns the WebSocket endpoint of chain, or an empty string when the
+// listener should poll. The <CHAIN>_WS_URL environment variable takes
+// precedence over the wsUrl set in evm_config.json.
+func WSURL(chain string, chainConfig ChainConfig) string {
+	if url := os.Getenv(strings.ToUpper(chain) + "_WS_URL"); url != "" {
+		return url
+	}
+	return chainConfig.WsUrl
+}
+
+// GetChainConfig returns the configuration of a single chain.
+func GetChainConfig(chain string) (ChainConfig, bool) {
+	EVMConfigMu.RLock()
+	defer EVMConfigMu.RUnlock()
+	chainConfig, ok := EVMConfig[strings.ToUpper(chain)]
+	return chainConfig, ok
 }
@@ -0,0 +1,49 @@
+package grifts
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"dumb-api/config"
+	"dumb-api/internal/candles"
+	"dumb-api/internal/retention"
+	"dumb-api/models"
+
+	"github.com/gobuffalo/grift/grift"
+)
+
+var _ = grift.Namespace("candles", func() {
+	grift.Desc("rebuild", "Rebuilds the candle tables from price_ticks, as far back as ticks are retained. Takes an optional RFC 3339 time or a duration such as 72h to only rebuild recent candles")
+	grift.Add("rebuild", func(c *grift.Context) error {
+		var since time.Time
+		if len(c.Args) > 0 {
+			if d, err := time.ParseDuration(c.Args[0]); err == nil {
+				since = time.Now().Add(-d)
+			} else if t, err := time.Parse(time.RFC3339, c.Args[0]); err == nil {
+				since = t
+			} else {
+				return fmt.Errorf("invalid start %q, expected an RFC 3339 time or a duration", c.Args[0])
+			}
+		}
+
+		// Candles older than the retained ticks cannot be rebuilt and are
+		// kept instead.
+		var oldest time.Time
+		if keep := config.Retention[retention.TicksTable]; keep > 0 {
+			oldest = time.Now().Add(-keep)
+		}
+		if since.Before(oldest) {
+			log.Printf("Price ticks are only kept for %s, candles before %v are kept as they are", config.Retention[retention.TicksTable], oldest)
+			since = oldest
+		}
+
+		log.Printf("Rebuilding candles since %v...", since)
+		began := time.Now()
+		if err := candles.Rebuild(models.DB, since, oldest); err != nil {
+			return err
+		}
+		log.Printf("Candles rebuilt in %s", time.Since(began).Round(time.Millisecond))
+		return nil
+	})
+})
@@ -0,0 +1,25 @@
+package grifts
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"dumb-api/config"
+	"dumb-api/internal/retention"
+	"dumb-api/models"
+
+	"github.com/gobuffalo/grift/grift"
+)
+
+var _ = grift.Namespace("retention", func() {
+	grift.Desc("run", "Downsamples and deletes the price ticks and candles past their retention, prunes the pool state history and creates the upcoming price_ticks partitions")
+	grift.Add("run", func(c *grift.Context) error {
+		began := time.Now()
+		if err := retention.Run(context.Background(), models.DB, config.Retention, began); err != nil {
+			return err
+		}
+		log.Printf("Retention applied in %s", time.Since(began).Round(time.Millisecond))
+		return nil
+	})
+})
@@ -22,7 +22,7 @@ var _ = grift.Namespace("tokens", func() {
 		coingeckoService := services.NewCoinGeckoService()
 		now := time.Now()
 
-		for chainName, chainConfig := range config.EVMConfig {
+		for chainName, chainConfig := range config.GetEVMConfig() {
 			log.Printf("Processing chain: %s", chainName)
 
 			for _, tokenConfig := range chainConfig.Tokens {
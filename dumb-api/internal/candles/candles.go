@@ -0,0 +1,366 @@
+// Package candles maintains OHLCV candles of price_ticks in one table per
+// interval. Candles are updated as ticks are recorded and can be rebuilt
+// from the raw ticks.
+package candles
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"dumb-api/models"
+
+	"github.com/gobuffalo/pop/v6"
+)
+
+// AllPools is the pool of the candles that aggregate the ticks of every pool
+// of a pair.
+const AllPools = ""
+
+// Interval is a candle width and the table its candles are kept in.
+type Interval struct {
+	Name     string
+	Duration time.Duration
+	Table    string
+}
+
+// Intervals are the candle widths maintained for every pair.
+var Intervals = []Interval{
+	{Name: "1m", Duration: time.Minute, Table: "candles_1m"},
+	{Name: "5m", Duration: 5 * time.Minute, Table: "candles_5m"},
+	{Name: "1h", Duration: time.Hour, Table: "candles_1h"},
+	{Name: "1d", Duration: 24 * time.Hour, Table: "candles_1d"},
+}
+
+// IntervalByName returns the interval called name.
+func IntervalByName(name string) (Interval, bool) {
+	for _, interval := range Intervals {
+		if interval.Name == name {
+			return interval, true
+		}
+	}
+	return Interval{}, false
+}
+
+// Bucket returns the start of the candle t falls into. Buckets are aligned to
+// the Unix epoch, so daily candles start at midnight UTC.
+func (i Interval) Bucket(t time.Time) time.Time {
+	return t.UTC().Truncate(i.Duration)
+}
+
+// Record adds tick to the candle of every interval it falls into, both for
+// its pool and for AllPools. Open and close are taken from the earliest and
+// latest tick of the bucket, so ticks recorded out of order still yield the
+// candle a rebuild would.
+func Record(db *pop.Connection, tick *models.PriceTick) error {
+	for _, interval := range Intervals {
+		pools := []string{AllPools}
+		if tick.Pool != AllPools {
+			pools = append(pools, tick.Pool)
+		}
+
+		for _, pool := range pools {
+			err := db.RawQuery(fmt.Sprintf(
+				`INSERT INTO %[1]s AS c (chain, pool, token_in, token_out, bucket, open, high, low, close, volume, trade_count, opened_at, closed_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?)
+				ON CONFLICT (chain, pool, token_in, token_out, bucket) DO UPDATE SET
+					open = CASE WHEN EXCLUDED.opened_at < c.opened_at THEN EXCLUDED.open ELSE c.open END,
+					close = CASE WHEN EXCLUDED.closed_at >= c.closed_at THEN EXCLUDED.close ELSE c.close END,
+					high = GREATEST(c.high, EXCLUDED.high),
+					low = LEAST(c.low, EXCLUDED.low),
+					volume = c.volume + EXCLUDED.volume,
+					trade_count = c.trade_count + EXCLUDED.trade_count,
+					opened_at = LEAST(c.opened_at, EXCLUDED.opened_at),
+					closed_at = GREATEST(c.closed_at, EXCLUDED.closed_at)`, interval.Table),
+				tick.Chain, pool, tick.TokenIn, tick.TokenOut, interval.Bucket(tick.CreatedAt),
+				tick.Price, tick.Price, tick.Price, tick.Price, tick.Volume, tick.CreatedAt, tick.CreatedAt,
+			).Exec()
+			if err != nil {
+				return fmt.Errorf("failed to update %s candle: %w", interval.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Rebuild recomputes every candle whose bucket starts at or after the one
+// since falls into from the raw ticks. Ticks are only kept from oldest on, or
+// forever when oldest is zero, so candles of earlier buckets are kept as they
+// are: since is clamped to oldest, and the bucket oldest falls into is only
+// rebuilt when it starts at oldest. Each table is locked while it is rebuilt
+// so ticks recorded meanwhile are not counted twice.
+func Rebuild(db *pop.Connection, since, oldest time.Time) error {
+	for _, interval := range Intervals {
+		start := interval.Bucket(since)
+		if start.Before(oldest) {
+			start = interval.Bucket(oldest)
+			if start.Before(oldest) {
+				start = start.Add(interval.Duration)
+			}
+		}
+
+		err := db.Transaction(func(tx *pop.Connection) error {
+			if err := tx.RawQuery(fmt.Sprintf("LOCK TABLE %s IN EXCLUSIVE MODE", interval.Table)).Exec(); err != nil {
+				return err
+			}
+			if err := tx.RawQuery(fmt.Sprintf("DELETE FROM %s WHERE bucket >= ?", interval.Table), start).Exec(); err != nil {
+				return err
+			}
+			return tx.RawQuery(fromTicks(interval, "created_at >= ?", ""), fromTicksArgs(interval, start)...).Exec()
+		})
+		if err != nil {
+			return fmt.Errorf("failed to rebuild %s candles: %w", interval.Name, err)
+		}
+	}
+	return nil
+}
+
+// Rollback deletes the ticks of chain recorded for the blocks after block,
+// which a reorg orphaned, and rebuilds the candles of chain they were counted
+// in from the remaining ticks.
+func Rollback(db *pop.Connection, chain string, block int64) error {
+	var row struct {
+		Since sql.NullTime `db:"since"`
+	}
+	err := db.RawQuery(
+		"SELECT MIN(created_at) AS since FROM price_ticks WHERE chain = ? AND block_number > ?",
+		chain, block,
+	).First(&row)
+	if err != nil {
+		return fmt.Errorf("failed to find the %s price ticks after block %d: %w", chain, block, err)
+	}
+	if !row.Since.Valid {
+		return nil
+	}
+
+	if err := db.RawQuery("DELETE FROM price_ticks WHERE chain = ? AND block_number > ?", chain, block).Exec(); err != nil {
+		return fmt.Errorf("failed to roll back %s price ticks to block %d: %w", chain, block, err)
+	}
+
+	for _, interval := range Intervals {
+		start := interval.Bucket(row.Since.Time)
+		if err := db.RawQuery(fmt.Sprintf("DELETE FROM %s WHERE chain = ? AND bucket >= ?", interval.Table), chain, start).Exec(); err != nil {
+			return fmt.Errorf("failed to roll back %s %s candles: %w", chain, interval.Name, err)
+		}
+		query := fromTicks(interval, "chain = ? AND created_at >= ?", "")
+		if err := db.RawQuery(query, fromTicksArgs(interval, chain, start)...).Exec(); err != nil {
+			return fmt.Errorf("failed to rebuild %s %s candles: %w", chain, interval.Name, err)
+		}
+	}
+	return nil
+}
+
+// Backfill adds the candles missing from every table for the ticks recorded
+// before before, keeping the candles already recorded. It is run before
+// expired ticks are deleted so that no price history is lost with them.
+func Backfill(db *pop.Connection, before time.Time) error {
+	for _, interval := range Intervals {
+		query := fromTicks(interval, "created_at < ?", "ON CONFLICT (chain, pool, token_in, token_out, bucket) DO NOTHING")
+		if err := db.RawQuery(query, fromTicksArgs(interval, before)...).Exec(); err != nil {
+			return fmt.Errorf("failed to backfill %s candles: %w", interval.Name, err)
+		}
+	}
+	return nil
+}
+
+// fromTicks returns the statement inserting the candles of interval
+// aggregated from the ticks matching where, whose arguments are passed to
+// fromTicksArgs.
+func fromTicks(interval Interval, where, conflict string) string {
+	return fmt.Sprintf(
+		`INSERT INTO %s (chain, pool, token_in, token_out, bucket, open, high, low, close, volume, trade_count, opened_at, closed_at)
+		SELECT t.chain, p.pool, t.token_in, t.token_out, t.bucket,
+			(array_agg(t.price ORDER BY t.created_at, t.id))[1],
+			MAX(t.price),
+			MIN(t.price),
+			(array_agg(t.price ORDER BY t.created_at DESC, t.id DESC))[1],
+			SUM(t.volume),
+			COUNT(*),
+			MIN(t.created_at),
+			MAX(t.created_at)
+		FROM (
+			SELECT *, to_timestamp(floor(extract(epoch FROM created_at) / ?) * ?) AS bucket
+			FROM price_ticks
+			WHERE %s AND price > 0
+		) t
+		CROSS JOIN LATERAL (VALUES (t.pool), (?)) AS p(pool)
+		GROUP BY t.chain, p.pool, t.token_in, t.token_out, t.bucket
+		%s`, interval.Table, where, conflict)
+}
+
+func fromTicksArgs(interval Interval, where ...interface{}) []interface{} {
+	seconds := interval.Duration.Seconds()
+	args := append([]interface{}{seconds, seconds}, where...)
+	return append(args, AllPools)
+}
+
+// Downsample aggregates the candles of interval whose bucket starts before
+// before into the candles of the next wider interval they fall into. before
+// is aligned to every interval, so the narrower candles cover each wider
+// bucket whole and replace what was recorded for it, correcting candles
+// written live from an incomplete set of ticks. It is run before expired
+// candles are deleted so that their history survives at the wider interval.
+func Downsample(db *pop.Connection, interval Interval, before time.Time) error {
+	wider, ok := next(interval)
+	if !ok {
+		return nil
+	}
+	seconds := wider.Duration.Seconds()
+
+	err := db.RawQuery(fmt.Sprintf(
+		`INSERT INTO %s (chain, pool, token_in, token_out, bucket, open, high, low, close, volume, trade_count, opened_at, closed_at)
+		SELECT chain, pool, token_in, token_out, to_timestamp(floor(extract(epoch FROM bucket) / ?) * ?) AS wide,
+			(array_agg(open ORDER BY opened_at))[1],
+			MAX(high),
+			MIN(low),
+			(array_agg(close ORDER BY closed_at DESC))[1],
+			SUM(volume),
+			SUM(trade_count),
+			MIN(opened_at),
+			MAX(closed_at)
+		FROM %s
+		WHERE bucket < ?
+		GROUP BY chain, pool, token_in, token_out, wide
+		ON CONFLICT (chain, pool, token_in, token_out, bucket) DO UPDATE SET
+			open = EXCLUDED.open,
+			high = EXCLUDED.high,
+			low = EXCLUDED.low,
+			close = EXCLUDED.close,
+			volume = EXCLUDED.volume,
+			trade_count = EXCLUDED.trade_count,
+			opened_at = EXCLUDED.opened_at,
+			closed_at = EXCLUDED.closed_at`, wider.Table, interval.Table),
+		seconds, seconds, before,
+	).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to downsample %s candles into %s: %w", interval.Name, wider.Name, err)
+	}
+	return nil
+}
+
+// next returns the interval after interval in Intervals.
+func next(interval Interval) (Interval, bool) {
+	for i, candidate := range Intervals {
+		if candidate.Name == interval.Name && i+1 < len(Intervals) {
+			return Intervals[i+1], true
+		}
+	}
+	return Interval{}, false
+}
+
+// Latest returns the most recent limit candles of interval for the pair
+// tokenIn/tokenOut in pool, oldest first. An empty chain matches every chain.
+func Latest(db *pop.Connection, interval Interval, chain, pool, tokenIn, tokenOut string, limit int) (models.Candles, error) {
+	query := fmt.Sprintf("SELECT * FROM %s WHERE pool = ? AND token_in = ? AND token_out = ?", interval.Table)
+	args := []interface{}{pool, tokenIn, tokenOut}
+	if chain != "" {
+		query += " AND chain = ?"
+		args = append(args, chain)
+	}
+	query += " ORDER BY bucket DESC LIMIT ?"
+	args = append(args, limit)
+
+	var result models.Candles
+	if err := db.RawQuery(query, args...).All(&result); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result, nil
+}
+
+// Range returns the candles of interval for the pair tokenIn/tokenOut in pool
+// whose bucket starts between from and to, oldest first, along with the last
+// candle before from, if any, to carry its close into the range. An empty
+// chain matches every chain.
+func Range(db *pop.Connection, interval Interval, chain, pool, tokenIn, tokenOut string, from, to time.Time) (models.Candles, *models.Candle, error) {
+	where := "pool = ? AND token_in = ? AND token_out = ?"
+	args := []interface{}{pool, tokenIn, tokenOut}
+	if chain != "" {
+		where += " AND chain = ?"
+		args = append(args, chain)
+	}
+
+	var result models.Candles
+	err := db.RawQuery(
+		fmt.Sprintf("SELECT * FROM %s WHERE %s AND bucket >= ? AND bucket <= ? ORDER BY bucket ASC", interval.Table, where),
+		append(args, interval.Bucket(from), to)...,
+	).All(&result)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var previous models.Candles
+	err = db.RawQuery(
+		fmt.Sprintf("SELECT * FROM %s WHERE %s AND bucket < ? ORDER BY bucket DESC LIMIT 1", interval.Table, where),
+		append(args, interval.Bucket(from))...,
+	).All(&previous)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(previous) == 0 {
+		return result, nil, nil
+	}
+	return result, &previous[0], nil
+}
+
+// Fill returns one candle per bucket of interval between from and to. Buckets
+// without ticks repeat the close of the candle before them, starting from
+// previous, with no volume. Buckets before the first known price are left
+// out.
+func Fill(interval Interval, rows models.Candles, previous *models.Candle, from, to time.Time) models.Candles {
+	byBucket := make(map[int64]models.Candle, len(rows))
+	for _, row := range rows {
+		byBucket[row.Bucket.Unix()] = row
+	}
+
+	var filled models.Candles
+	last := previous
+	for bucket := interval.Bucket(from); !bucket.After(to); bucket = bucket.Add(interval.Duration) {
+		if row, ok := byBucket[bucket.Unix()]; ok {
+			filled = append(filled, row)
+			last = &filled[len(filled)-1]
+			continue
+		}
+		if last == nil {
+			continue
+		}
+		filled = append(filled, models.Candle{
+			Chain:    last.Chain,
+			Pool:     last.Pool,
+			TokenIn:  last.TokenIn,
+			TokenOut: last.TokenOut,
+			Bucket:   bucket,
+			Open:     last.Close,
+			High:     last.Close,
+			Low:      last.Close,
+			Close:    last.Close,
+			OpenedAt: bucket,
+			ClosedAt: bucket,
+		})
+		last = &filled[len(filled)-1]
+	}
+	return filled
+}
+
+// Invert turns a candle of tokenOut/tokenIn into one of tokenIn/tokenOut.
+// Volume is converted into the new base token at the candle's close.
+func Invert(c models.Candle) models.Candle {
+	inverted := c
+	inverted.TokenIn, inverted.TokenOut = c.TokenOut, c.TokenIn
+	inverted.Open = reciprocal(c.Open)
+	inverted.High = reciprocal(c.Low)
+	inverted.Low = reciprocal(c.High)
+	inverted.Close = reciprocal(c.Close)
+	inverted.Volume = c.Volume * c.Close
+	return inverted
+}
+
+func reciprocal(price float64) float64 {
+	if price == 0 {
+		return 0
+	}
+	return 1 / price
+}
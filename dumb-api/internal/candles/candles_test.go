@@ -0,0 +1,106 @@
+package candles
+
+import (
+	"testing"
+	"time"
+
+	"dumb-api/models"
+)
+
+func TestFill(t *testing.T) {
+	interval, _ := IntervalByName("1m")
+	start := time.Date(2024, 10, 20, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	candle := func(minutes int, open, close, volume float64) models.Candle {
+		return models.Candle{Bucket: at(minutes), Open: open, High: max(open, close), Low: min(open, close), Close: close, Volume: volume}
+	}
+
+	type bucket struct {
+		minutes     int
+		open, close float64
+		volume      float64
+	}
+
+	tests := []struct {
+		name     string
+		rows     models.Candles
+		previous *models.Candle
+		from, to time.Time
+		want     []bucket
+	}{
+		{
+			name: "gaps repeat the previous close",
+			rows: models.Candles{candle(0, 1, 2, 5), candle(3, 3, 4, 7)},
+			from: at(0), to: at(4),
+			want: []bucket{{0, 1, 2, 5}, {1, 2, 2, 0}, {2, 2, 2, 0}, {3, 3, 4, 7}, {4, 4, 4, 0}},
+		},
+		{
+			name: "buckets before the first price are left out",
+			rows: models.Candles{candle(2, 1, 2, 5)},
+			from: at(0), to: at(3),
+			want: []bucket{{2, 1, 2, 5}, {3, 2, 2, 0}},
+		},
+		{
+			name:     "leading gaps start from the previous candle",
+			rows:     models.Candles{candle(2, 3, 4, 5)},
+			previous: &models.Candle{Bucket: at(-5), Close: 1.5},
+			from:     at(0), to: at(2),
+			want: []bucket{{0, 1.5, 1.5, 0}, {1, 1.5, 1.5, 0}, {2, 3, 4, 5}},
+		},
+		{
+			name: "from is aligned to its bucket",
+			rows: models.Candles{candle(0, 1, 2, 5)},
+			from: at(0).Add(30 * time.Second), to: at(1),
+			want: []bucket{{0, 1, 2, 5}, {1, 2, 2, 0}},
+		},
+		{
+			name: "no rows and no previous candle",
+			from: at(0), to: at(3),
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filled := Fill(interval, tt.rows, tt.previous, tt.from, tt.to)
+			if len(filled) != len(tt.want) {
+				t.Fatalf("Fill returned %d candles, want %d", len(filled), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := filled[i]
+				if !got.Bucket.Equal(at(want.minutes)) || got.Open != want.open || got.Close != want.close || got.Volume != want.volume {
+					t.Errorf("candle %d is %s open %g close %g volume %g, want %s open %g close %g volume %g", i,
+						got.Bucket.Format(time.RFC3339), got.Open, got.Close, got.Volume,
+						at(want.minutes).Format(time.RFC3339), want.open, want.close, want.volume)
+				}
+			}
+		})
+	}
+}
+
+func TestInvert(t *testing.T) {
+	tests := []struct {
+		name   string
+		candle models.Candle
+		want   models.Candle
+	}{
+		{
+			name:   "prices are reciprocal and high and low swap",
+			candle: models.Candle{TokenIn: "a", TokenOut: "b", Open: 2, High: 4, Low: 0.5, Close: 0.25, Volume: 8},
+			want:   models.Candle{TokenIn: "b", TokenOut: "a", Open: 0.5, High: 2, Low: 0.25, Close: 4, Volume: 2},
+		},
+		{
+			name:   "zero prices stay zero",
+			candle: models.Candle{TokenIn: "a", TokenOut: "b", Open: 0, High: 2, Low: 0, Close: 0, Volume: 3},
+			want:   models.Candle{TokenIn: "b", TokenOut: "a", Open: 0, High: 0, Low: 0.5, Close: 0, Volume: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Invert(tt.candle); got != tt.want {
+				t.Errorf("Invert(%+v) = %+v, want %+v", tt.candle, got, tt.want)
+			}
+		})
+	}
+}
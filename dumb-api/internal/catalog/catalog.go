@@ -0,0 +1,246 @@
+// Package catalog describes the pools recorded in pool_states: their tokens,
+// DEX, status and TVL, and for those the graph routes through, their fee and
+// live state.
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"dumb-api/config"
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/streams"
+	"dumb-api/internal/tokens"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobuffalo/pop/v6"
+)
+
+// ErrNotFound is returned when no pool has the requested address.
+var ErrNotFound = errors.New("pool not found")
+
+// Filter selects and orders the pools List returns. Empty fields match
+// every pool.
+type Filter struct {
+	// Chain is the lowercase name of the chain.
+	Chain string
+	// Token matches the pools trading it on either side.
+	Token string
+	// Dex is the type of the DEX, such as uniswapV3.
+	Dex string
+	// Status is active or retired.
+	Status string
+	// Ascending lists the smallest TVL first instead of the largest.
+	Ascending bool
+	Limit     int
+	Offset    int
+}
+
+// Pool is a pool and its latest TVL. Fee is only known for tracked pools.
+type Pool struct {
+	Chain   string `json:"chain" db:"chain"`
+	Address string `json:"address" db:"address"`
+	Dex     string `json:"dex" db:"-"`
+	Factory string `json:"factory" db:"factory"`
+	Token0  string `json:"token0" db:"token0"`
+	Token1  string `json:"token1" db:"token1"`
+	// Fee is the swap fee in hundredths of a basis point.
+	Fee    uint32  `json:"fee,omitempty" db:"-"`
+	Status string  `json:"status" db:"status"`
+	TVLUSD float64 `json:"tvlUsd" db:"tvl_usd"`
+	// Tracked reports whether the graph routes through the pool.
+	Tracked bool `json:"tracked" db:"-"`
+}
+
+// Detail is a pool along with its live state.
+type Detail struct {
+	Pool
+	// State holds what the price of the pool derives from, as reported by
+	// its adapter: its reserves, or its sqrt price, tick and liquidity.
+	State interface{} `json:"state,omitempty"`
+	// Price0 is the spot price of token0 in token1 and Price1 the price of
+	// token1 in token0, both normalized by the decimals of the tokens.
+	Price0 float64 `json:"price0,omitempty"`
+	Price1 float64 `json:"price1,omitempty"`
+	// LastUpdateBlock is the last block that changed the pool, unknown when
+	// it did not change since the process started.
+	LastUpdateBlock int64 `json:"lastUpdateBlock,omitempty"`
+}
+
+const selectPools = `SELECT p.chain_id AS chain, p.pair AS address, p.factory, p.token0, p.token1, p.status,
+	COALESCE(t.tvl_usd, 0) AS tvl_usd
+FROM pool_states p
+LEFT JOIN pool_tvl t ON t.chain = p.chain_id AND t.pool = p.pair AND t.dex <> 'bridge'`
+
+// List returns the pools matching filter, by TVL, and how many match in
+// total.
+func List(db *pop.Connection, g *graph.Graph, filter Filter) ([]Pool, int, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Chain != "" {
+		conditions = append(conditions, "p.chain_id = ?")
+		args = append(args, filter.Chain)
+	}
+	if filter.Token != "" {
+		token := strings.ToLower(filter.Token)
+		conditions = append(conditions, "(LOWER(p.token0) = ? OR LOWER(p.token1) = ?)")
+		args = append(args, token, token)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "p.status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.Dex != "" {
+		// pool_states does not record the DEX, which is the one configured
+		// with the factory of the pool.
+		var factories []string
+		for chain, dexByFactory := range dexesByFactory() {
+			if filter.Chain != "" && chain != filter.Chain {
+				continue
+			}
+			for factory, dex := range dexByFactory {
+				if dex == filter.Dex {
+					factories = append(factories, "(?, ?)")
+					args = append(args, chain, factory)
+				}
+			}
+		}
+		if len(factories) == 0 {
+			return []Pool{}, 0, nil
+		}
+		conditions = append(conditions, "(p.chain_id, LOWER(p.factory)) IN ("+strings.Join(factories, ", ")+")")
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var count struct {
+		Total int `db:"total"`
+	}
+	if err := db.RawQuery("SELECT COUNT(*) AS total FROM pool_states p"+where, args...).First(&count); err != nil {
+		return nil, 0, fmt.Errorf("failed to count pools: %w", err)
+	}
+
+	order := "DESC"
+	if filter.Ascending {
+		order = "ASC"
+	}
+	pools := []Pool{}
+	err := db.RawQuery(
+		selectPools+where+" ORDER BY tvl_usd "+order+", p.chain_id, p.pair LIMIT ? OFFSET ?",
+		append(args, filter.Limit, filter.Offset)...,
+	).All(&pools)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list pools: %w", err)
+	}
+
+	describe(g, pools)
+	return pools, count.Total, nil
+}
+
+// Get returns the pool at address, on chain when it is not empty.
+func Get(db *pop.Connection, g *graph.Graph, chain, address string) (*Detail, error) {
+	query := selectPools + " WHERE LOWER(p.pair) = ?"
+	args := []interface{}{strings.ToLower(address)}
+	if chain != "" {
+		query += " AND p.chain_id = ?"
+		args = append(args, chain)
+	}
+
+	pools := []Pool{}
+	if err := db.RawQuery(query+" ORDER BY p.chain_id LIMIT 1", args...).All(&pools); err != nil {
+		return nil, fmt.Errorf("failed to get pool %s: %w", address, err)
+	}
+	if len(pools) == 0 {
+		return nil, ErrNotFound
+	}
+	describe(g, pools)
+
+	detail := &Detail{Pool: pools[0]}
+	if block, ok := streams.PoolBlock(detail.Address); ok {
+		detail.LastUpdateBlock = block
+	}
+
+	g.Mu.RLock()
+	info, ok := inspect(g, detail.Chain, detail.Address)
+	g.Mu.RUnlock()
+	if !ok {
+		return detail, nil
+	}
+	detail.State = info.State
+	if info.Price != nil && info.Price.Sign() > 0 {
+		decimals0, ok0 := tokens.Decimals(detail.Chain, common.HexToAddress(detail.Token0))
+		decimals1, ok1 := tokens.Decimals(detail.Chain, common.HexToAddress(detail.Token1))
+		if ok0 && ok1 {
+			scale := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(decimals0-decimals1))), nil))
+			price := new(big.Float).Set(info.Price)
+			if decimals0 > decimals1 {
+				price.Mul(price, scale)
+			} else {
+				price.Quo(price, scale)
+			}
+			detail.Price0, _ = price.Float64()
+			detail.Price1, _ = new(big.Float).Quo(big.NewFloat(1), price).Float64()
+		}
+	}
+	return detail, nil
+}
+
+// describe fills in the DEX of pools, and the fee of those g tracks.
+func describe(g *graph.Graph, pools []Pool) {
+	byFactory := dexesByFactory()
+	for i := range pools {
+		pools[i].Dex = byFactory[pools[i].Chain][strings.ToLower(pools[i].Factory)]
+	}
+
+	g.Mu.RLock()
+	defer g.Mu.RUnlock()
+	for i := range pools {
+		if info, ok := inspect(g, pools[i].Chain, pools[i].Address); ok {
+			pools[i].Tracked = true
+			pools[i].Fee = info.Fee
+		}
+	}
+}
+
+// inspect describes the pool at address when g tracks it on chain. The
+// caller must hold a read lock on g.
+func inspect(g *graph.Graph, chain, address string) (dexes.PoolInfo, bool) {
+	pool := g.GetPool(common.HexToAddress(address).Hex())
+	if pool == nil || pool.Chain != chain {
+		return dexes.PoolInfo{}, false
+	}
+	inspector, ok := dexes.AdapterFor(pool).(dexes.Inspector)
+	if !ok {
+		return dexes.PoolInfo{}, false
+	}
+	return inspector.Inspect(g, pool)
+}
+
+// dexesByFactory returns the DEX type of every configured factory, by
+// lowercase chain name and lowercase factory address.
+func dexesByFactory() map[string]map[string]string {
+	result := make(map[string]map[string]string)
+	for name, chainConfig := range config.GetEVMConfig() {
+		chain := strings.ToLower(name)
+		result[chain] = make(map[string]string)
+		for _, dexConfig := range chainConfig.DexConfigs() {
+			for _, factory := range dexConfig.Factories {
+				result[chain][strings.ToLower(factory)] = dexConfig.Type
+			}
+		}
+	}
+	return result
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
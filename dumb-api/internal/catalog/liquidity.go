@@ -0,0 +1,191 @@
+package catalog
+
+import (
+	"errors"
+	"math"
+	"math/big"
+
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/tokens"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	// ErrNoTickLiquidity is returned for pools that do not concentrate
+	// their liquidity in tick ranges.
+	ErrNoTickLiquidity = errors.New("pool has no tick liquidity")
+
+	// ErrUnknownDecimals is returned when the decimals of a token of the
+	// pool are not known, so its amounts and prices cannot be normalized.
+	ErrUnknownDecimals = errors.New("token decimals unknown")
+)
+
+// TickRange is the liquidity active between two neighbouring initialized
+// ticks. Prices are of token0 in token1 and amounts are normalized by the
+// decimals of the tokens.
+type TickRange struct {
+	TickLower  int     `json:"tickLower"`
+	TickUpper  int     `json:"tickUpper"`
+	PriceLower float64 `json:"priceLower"`
+	PriceUpper float64 `json:"priceUpper"`
+	Liquidity  string  `json:"liquidity"`
+	// Amount0 and Amount1 are the tokens the range holds at the current
+	// price: token0 above it and token1 below it.
+	Amount0 float64 `json:"amount0"`
+	Amount1 float64 `json:"amount1"`
+	// Cumulative0 is the token0 bought by moving the price up to
+	// PriceUpper, and Cumulative1 the token1 bought by moving it down to
+	// PriceLower.
+	Cumulative0 float64 `json:"cumulative0"`
+	Cumulative1 float64 `json:"cumulative1"`
+}
+
+// DepthLevel is how much of each token a price move of Percent buys.
+type DepthLevel struct {
+	Percent float64 `json:"percent"`
+	// Amount0 is the token0 bought by moving the price up by Percent, and
+	// Amount1 the token1 bought by moving it down by Percent.
+	Amount0 float64 `json:"amount0"`
+	Amount1 float64 `json:"amount1"`
+}
+
+// LiquidityChart is the liquidity of a pool around its current price.
+type LiquidityChart struct {
+	Chain     string       `json:"chain"`
+	Pool      string       `json:"pool"`
+	Token0    string       `json:"token0"`
+	Token1    string       `json:"token1"`
+	Tick      int          `json:"tick"`
+	Price     float64      `json:"price"`
+	Liquidity string       `json:"liquidity"`
+	Ranges    []TickRange  `json:"ranges"`
+	Depth     []DepthLevel `json:"depth"`
+}
+
+// Liquidity charts the tick ranges of the pool at address whose prices are
+// within window of the current price, and the depth of the pool at each of
+// levels. window and levels are fractions, 0.1 standing for 10%. An empty
+// chain matches the pool on any chain.
+func Liquidity(g *graph.Graph, chain, address string, window float64, levels []float64) (*LiquidityChart, error) {
+	g.Mu.RLock()
+	pool := g.GetPool(common.HexToAddress(address).Hex())
+	if pool == nil || (chain != "" && pool.Chain != chain) {
+		g.Mu.RUnlock()
+		return nil, ErrNotFound
+	}
+	reader, ok := dexes.AdapterFor(pool).(dexes.LiquidityReader)
+	if !ok {
+		g.Mu.RUnlock()
+		return nil, ErrNoTickLiquidity
+	}
+	distribution, ok := reader.Liquidity(g, pool)
+	g.Mu.RUnlock()
+	if !ok {
+		return nil, ErrNoTickLiquidity
+	}
+
+	decimals0, ok0 := tokens.Decimals(pool.Chain, common.HexToAddress(pool.Token0))
+	decimals1, ok1 := tokens.Decimals(pool.Chain, common.HexToAddress(pool.Token1))
+	if !ok0 || !ok1 {
+		return nil, ErrUnknownDecimals
+	}
+	scale0 := math.Pow10(decimals0)
+	scale1 := math.Pow10(decimals1)
+	priceScale := math.Pow10(decimals0 - decimals1)
+
+	sqrtPrice, _ := new(big.Float).Quo(
+		new(big.Float).SetInt(distribution.SqrtPriceX96),
+		new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 96)),
+	).Float64()
+	price := sqrtPrice * sqrtPrice * priceScale
+
+	chart := &LiquidityChart{
+		Chain:     pool.Chain,
+		Pool:      pool.Pair,
+		Token0:    pool.Token0,
+		Token1:    pool.Token1,
+		Tick:      distribution.Tick,
+		Price:     price,
+		Liquidity: distribution.Liquidity.String(),
+		Ranges:    []TickRange{},
+	}
+
+	ranges := make([]TickRange, len(distribution.Ranges))
+	spans := make([]span, len(distribution.Ranges))
+	for i, r := range distribution.Ranges {
+		liquidity, _ := new(big.Float).SetInt(r.Liquidity).Float64()
+		spans[i] = span{liquidity: liquidity, lower: sqrtPriceAt(r.TickLower), upper: sqrtPriceAt(r.TickUpper)}
+		ranges[i] = TickRange{
+			TickLower:  r.TickLower,
+			TickUpper:  r.TickUpper,
+			PriceLower: spans[i].lower * spans[i].lower * priceScale,
+			PriceUpper: spans[i].upper * spans[i].upper * priceScale,
+			Liquidity:  r.Liquidity.String(),
+			Amount0:    spans[i].amount0(sqrtPrice, math.Inf(1)) / scale0,
+			Amount1:    spans[i].amount1(0, sqrtPrice) / scale1,
+		}
+	}
+	// Token0 is bought from the current price up, token1 from it down.
+	var cumulative float64
+	for i := range ranges {
+		cumulative += ranges[i].Amount0
+		ranges[i].Cumulative0 = cumulative
+	}
+	cumulative = 0
+	for i := len(ranges) - 1; i >= 0; i-- {
+		cumulative += ranges[i].Amount1
+		ranges[i].Cumulative1 = cumulative
+	}
+
+	for _, r := range ranges {
+		if r.PriceUpper >= price*(1-window) && r.PriceLower <= price*(1+window) {
+			chart.Ranges = append(chart.Ranges, r)
+		}
+	}
+
+	for _, level := range levels {
+		up, down := sqrtPrice*math.Sqrt(1+level), sqrtPrice*math.Sqrt(max(1-level, 0))
+		depth := DepthLevel{Percent: level * 100}
+		for _, s := range spans {
+			depth.Amount0 += s.amount0(sqrtPrice, up) / scale0
+			depth.Amount1 += s.amount1(down, sqrtPrice) / scale1
+		}
+		chart.Depth = append(chart.Depth, depth)
+	}
+
+	return chart, nil
+}
+
+// sqrtPriceAt returns the square root of the raw price at tick.
+func sqrtPriceAt(tick int) float64 {
+	return math.Pow(1.0001, float64(tick)/2)
+}
+
+// span is the liquidity of a tick range between the square roots of its
+// raw lower and upper prices.
+type span struct {
+	liquidity    float64
+	lower, upper float64
+}
+
+// amount0 returns the raw token0 the span holds between the square root
+// prices from and to.
+func (s span) amount0(from, to float64) float64 {
+	a, b := max(s.lower, from), min(s.upper, to)
+	if b <= a {
+		return 0
+	}
+	return s.liquidity * (1/a - 1/b)
+}
+
+// amount1 returns the raw token1 the span holds between the square root
+// prices from and to.
+func (s span) amount1(from, to float64) float64 {
+	a, b := max(s.lower, from), min(s.upper, to)
+	if b <= a {
+		return 0
+	}
+	return s.liquidity * (b - a)
+}
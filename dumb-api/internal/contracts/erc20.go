@@ -0,0 +1,49 @@
+package contracts
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	// balanceOfSelector is the selector of ERC20 balanceOf(address).
+	balanceOfSelector = common.FromHex("0x70a08231")
+	// decimalsSelector is the selector of ERC20 decimals().
+	decimalsSelector = common.FromHex("0x313ce567")
+)
+
+// BalanceOf returns the balance of owner in the ERC20 token. Only a couple of
+// calls are needed from ERC20 contracts, so they are encoded by hand rather
+// than generated.
+func BalanceOf(ctx context.Context, caller bind.ContractCaller, token, owner common.Address) (*big.Int, error) {
+	data := append(append([]byte{}, balanceOfSelector...), common.LeftPadBytes(owner.Bytes(), 32)...)
+	result, err := caller.CallContract(ctx, ethereum.CallMsg{To: &token, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) < 32 {
+		return nil, fmt.Errorf("invalid balanceOf result from %s", token)
+	}
+	return new(big.Int).SetBytes(result[:32]), nil
+}
+
+// Decimals returns the decimals of the ERC20 token.
+func Decimals(ctx context.Context, caller bind.ContractCaller, token common.Address) (int, error) {
+	result, err := caller.CallContract(ctx, ethereum.CallMsg{To: &token, Data: decimalsSelector}, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(result) < 32 {
+		return 0, fmt.Errorf("invalid decimals result from %s", token)
+	}
+	decimals := new(big.Int).SetBytes(result[:32])
+	if !decimals.IsUint64() || decimals.Uint64() > 77 {
+		return 0, fmt.Errorf("invalid decimals %s of %s", decimals, token)
+	}
+	return int(decimals.Uint64()), nil
+}
@@ -0,0 +1,333 @@
+package dexes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dumb-api/config"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/rpcpool"
+	"dumb-api/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gofrs/uuid"
+)
+
+// PairFilter reports whether the pair tokenA/tokenB should be looked up on factory.
+type PairFilter func(factory, tokenA, tokenB common.Address) bool
+
+// DexAdapter integrates one AMM design with the graph. Adapters are registered
+// by type name and instantiated per evm_config.json entry, so supporting a new
+// AMM only requires a package that calls Register.
+type DexAdapter interface {
+	// Type returns the name the adapter is registered under.
+	Type() string
+	// Chain returns the chain the adapter was instantiated for.
+	Chain() string
+	// DiscoverPools looks up the pools of every token pair accepted by include
+	// (all pairs when include is nil). It stops early when ctx is cancelled.
+	DiscoverPools(ctx context.Context, tokens []string, include PairFilter) []*graph.Pool
+	// BuildEdges loads the current on-chain state of pool and returns its
+	// token0->token1 and token1->token0 edges.
+	BuildEdges(ctx context.Context, pool *graph.Pool) (graph.Edge, graph.Edge, error)
+	// Topics returns the event topics the adapter needs to keep pools in sync.
+	Topics() []common.Hash
+	// ApplyLog updates the state of pool in g from vLog and returns the price
+	// samples of the edges it moved.
+	ApplyLog(g *graph.Graph, pool *graph.Pool, vLog types.Log) []*graph.PriceSample
+	// ExportState serializes the current state of pool in g.
+	ExportState(g *graph.Graph, pool *graph.Pool) ([]byte, error)
+	// ImportState rebuilds the edges of pool from data produced by ExportState.
+	ImportState(pool *graph.Pool, data []byte) (graph.Edge, graph.Edge, error)
+}
+
+// Swap is a trade decoded from a pool event. Amounts are in raw token units
+// from the pool's side: positive amounts were paid into the pool, negative
+// ones were paid out of it.
+type Swap struct {
+	Amount0 *big.Int
+	Amount1 *big.Int
+}
+
+// SwapDecoder is implemented by adapters whose pools emit an event per trade,
+// so the trades can be indexed for volume.
+type SwapDecoder interface {
+	// DecodeSwap returns the swap vLog records, or false when vLog is not a
+	// swap event.
+	DecodeSwap(vLog types.Log) (Swap, bool)
+}
+
+// BalanceReader is implemented by adapters able to tell the token amounts a
+// pool holds, which are valued as its TVL.
+type BalanceReader interface {
+	// PoolBalances returns the amounts of token0 and token1 held by pool.
+	// g must not be locked by the caller.
+	PoolBalances(ctx context.Context, g *graph.Graph, pool *graph.Pool) (*big.Int, *big.Int, error)
+}
+
+// DepthReader is implemented by adapters able to tell how much of each token
+// a pool can trade around its current price, from the state of its edges.
+type DepthReader interface {
+	// Depth returns the amounts of token0 and token1 backing the current
+	// price of pool. The caller must hold a read lock on g.
+	Depth(g *graph.Graph, pool *graph.Pool) (*big.Int, *big.Int, bool)
+}
+
+// Observation is the time-weighted state of a pool over a window, read from
+// its on-chain oracle.
+type Observation struct {
+	// MeanTick is the arithmetic mean tick over the window, the price of
+	// which is the geometric mean price of token0 in token1.
+	MeanTick int
+	// HarmonicMeanLiquidity is the harmonic mean of the in-range liquidity
+	// over the window.
+	HarmonicMeanLiquidity *big.Int
+}
+
+// Oracle is implemented by adapters whose pools keep a price oracle.
+type Oracle interface {
+	// Observe returns the observation of pool over the window ending at the
+	// latest block. It fails when the oracle does not reach back that far.
+	Observe(ctx context.Context, pool *graph.Pool, window time.Duration) (Observation, error)
+}
+
+// PoolInfo describes the current state of a pool.
+type PoolInfo struct {
+	// Fee is the swap fee in hundredths of a basis point, as Uniswap V3 fee
+	// tiers are expressed.
+	Fee uint32
+	// State holds the fields the price of the pool derives from, such as its
+	// reserves, or its sqrt price, tick and in-range liquidity.
+	State interface{}
+	// Price is the spot price of token0 in token1, in raw token units. It is
+	// nil when the pool is empty.
+	Price *big.Float
+}
+
+// Inspector is implemented by adapters able to describe the state of their
+// pools.
+type Inspector interface {
+	// Inspect describes pool, or returns false when g has no edge for it.
+	// The caller must hold a read lock on g.
+	Inspect(g *graph.Graph, pool *graph.Pool) (PoolInfo, bool)
+}
+
+// LiquidityRange is the liquidity active while the price of a pool is
+// between two neighbouring initialized ticks.
+type LiquidityRange struct {
+	TickLower int
+	TickUpper int
+	Liquidity *big.Int
+}
+
+// LiquidityDistribution is the liquidity of a concentrated liquidity pool
+// across its price range.
+type LiquidityDistribution struct {
+	Tick         int
+	SqrtPriceX96 *big.Int
+	// Liquidity is the liquidity active at the current tick.
+	Liquidity *big.Int
+	// Ranges are ordered by tick and span every initialized tick.
+	Ranges []LiquidityRange
+}
+
+// LiquidityReader is implemented by adapters whose pools concentrate
+// liquidity in tick ranges.
+type LiquidityReader interface {
+	// Liquidity returns the liquidity distribution of pool, or false when
+	// g has no edge for it. The caller must hold a read lock on g.
+	Liquidity(g *graph.Graph, pool *graph.Pool) (LiquidityDistribution, bool)
+}
+
+// AdapterFactory instantiates an adapter for a chain from its config entry.
+type AdapterFactory func(chain string, dexConfig config.DexConfig, client rpcpool.Client) DexAdapter
+
+var (
+	factories = make(map[string]AdapterFactory)
+
+	adaptersMu sync.RWMutex
+	// adapters are keyed by chain, then DEX id. dexIDs maps the type and
+	// factory of each chain's pools to the id of their DEX.
+	adapters = make(map[string]map[string]DexAdapter)
+	dexIDs   = make(map[string]map[string]string)
+)
+
+// Register makes an adapter type available to evm_config.json entries. It is
+// meant to be called from the init function of the adapter package.
+func Register(dexType string, factory AdapterFactory) {
+	if _, exists := factories[dexType]; exists {
+		panic(fmt.Sprintf("dex adapter %s registered twice", dexType))
+	}
+	factories[dexType] = factory
+}
+
+// ID identifies a DEX config entry by its type and set of factories, which
+// tells apart entries of the same type on a chain.
+func ID(dexConfig config.DexConfig) string {
+	factories := make([]string, len(dexConfig.Factories))
+	for i, factory := range dexConfig.Factories {
+		factories[i] = strings.ToLower(factory)
+	}
+	sort.Strings(factories)
+	return dexConfig.Type + ":" + strings.Join(factories, ",")
+}
+
+// NewAdapter instantiates the adapter of dexConfig.Type for chain and makes it
+// the owner of that chain's pools created by the factories of dexConfig. The
+// pools it discovers carry the entry's ID.
+func NewAdapter(chain string, dexConfig config.DexConfig, client rpcpool.Client) (DexAdapter, error) {
+	factory, ok := factories[dexConfig.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown dex type %q", dexConfig.Type)
+	}
+
+	adapter := factory(chain, dexConfig, client)
+	id := ID(dexConfig)
+
+	adaptersMu.Lock()
+	if adapters[chain] == nil {
+		adapters[chain] = make(map[string]DexAdapter)
+		dexIDs[chain] = make(map[string]string)
+	}
+	adapters[chain][id] = adapter
+	for _, factory := range dexConfig.Factories {
+		dexIDs[chain][dexConfig.Type+":"+strings.ToLower(factory)] = id
+	}
+	adaptersMu.Unlock()
+
+	return adapter, nil
+}
+
+// IDFor returns the id of the DEX of type dexType configured with factory on
+// chain, or "" when no such adapter was instantiated. It identifies the DEX
+// of pools rebuilt from stored rows, which only record type and factory.
+func IDFor(chain, dexType, factory string) string {
+	adaptersMu.RLock()
+	defer adaptersMu.RUnlock()
+	return dexIDs[chain][dexType+":"+strings.ToLower(factory)]
+}
+
+// AdapterFor returns the adapter owning pool, or nil if none was instantiated.
+func AdapterFor(pool *graph.Pool) DexAdapter {
+	adaptersMu.RLock()
+	defer adaptersMu.RUnlock()
+	return adapters[pool.Chain][pool.DexID]
+}
+
+// ChainAdapters returns the adapters instantiated for chain.
+func ChainAdapters(chain string) []DexAdapter {
+	adaptersMu.RLock()
+	defer adaptersMu.RUnlock()
+
+	result := make([]DexAdapter, 0, len(adapters[chain]))
+	for _, adapter := range adapters[chain] {
+		result = append(result, adapter)
+	}
+	return result
+}
+
+// Bootstrap discovers the pools of adapter, builds their edges and records
+// them in pool_states and edge_states. The edges are returned in a staging
+// graph so callers decide when to merge them into the live one. Callers must
+// discard the staging graph when ctx was cancelled, as it may be partial.
+func Bootstrap(ctx context.Context, adapter DexAdapter, tokens []string, include PairFilter) *graph.Graph {
+	staged := graph.NewGraph()
+	now := time.Now()
+
+	for _, pool := range adapter.DiscoverPools(ctx, tokens, include) {
+		if ctx.Err() != nil {
+			break
+		}
+		pool.DexID = IDFor(pool.Chain, pool.Dex, pool.Factory)
+
+		edge01, edge10, err := adapter.BuildEdges(ctx, pool)
+		if err != nil {
+			log.Printf("Failed to build edges for pool %s: %v", pool.Pair, err)
+			continue
+		}
+
+		staged.AddPool(pool)
+		if edge01 != nil {
+			staged.NewEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain, edge01)
+		}
+		if edge10 != nil {
+			staged.NewEdge(pool.Token1, pool.Token0, pool.Pair, pool.Chain, edge10)
+		}
+
+		savePoolState(pool, edge01, edge10, now)
+	}
+
+	return staged
+}
+
+func savePoolState(pool *graph.Pool, edge01, edge10 graph.Edge, now time.Time) {
+	poolState := &models.PoolState{
+		ID:        uuid.Must(uuid.NewV4()),
+		Token0:    pool.Token0,
+		Token1:    pool.Token1,
+		Pair:      pool.Pair,
+		Factory:   pool.Factory,
+		ChainID:   pool.Chain,
+		Status:    "active",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := models.DB.Create(poolState); err != nil {
+		log.Printf("Error saving pool to database: %v", err)
+	}
+
+	saveEdgeState(pool.Chain, pool.Token0, pool.Token1, pool.Pair, edge01, now)
+	saveEdgeState(pool.Chain, pool.Token1, pool.Token0, pool.Pair, edge10, now)
+}
+
+func saveEdgeState(chain, token0, token1, pair string, edge graph.Edge, now time.Time) {
+	if edge == nil {
+		return
+	}
+
+	exported := edge.Export()
+	if len(exported) == 0 {
+		return
+	}
+
+	edgeState := &models.EdgeState{
+		ID:        uuid.Must(uuid.NewV4()),
+		ChainID:   chain,
+		Token0:    token0,
+		Token1:    token1,
+		PoolID:    pair,
+		EdgeData:  []byte(exported[0]),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := models.DB.Create(edgeState); err != nil {
+		log.Printf("Error saving edge %s -> %s to database: %v", token0, token1, err)
+	}
+}
+
+// UpdatePoolEdges applies vLog to both directional edges of pool and returns
+// their price samples.
+func UpdatePoolEdges(g *graph.Graph, pool *graph.Pool, vLog types.Log) []*graph.PriceSample {
+	var samples []*graph.PriceSample
+	for _, edge := range []graph.Edge{
+		g.GetEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain),
+		g.GetEdge(pool.Token1, pool.Token0, pool.Pair, pool.Chain),
+	} {
+		if edge == nil {
+			continue
+		}
+		if sample := edge.UpdateEdge(vLog, pool.Chain); sample != nil {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
@@ -0,0 +1,250 @@
+package uniswapv2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+
+	"dumb-api/config"
+	"dumb-api/internal/contracts"
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/graph/edges"
+	"dumb-api/internal/rpcpool"
+	"dumb-api/internal/utils"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Type is the name Uniswap V2 style entries use in evm_config.json.
+const Type = "uniswapV2"
+
+func init() {
+	dexes.Register(Type, New)
+}
+
+// Adapter discovers and tracks constant product pairs created by a set of
+// Uniswap V2 compatible factories.
+type Adapter struct {
+	chain     string
+	factories []string
+	client    rpcpool.Client
+}
+
+type poolState struct {
+	Reserve0 string `json:"reserve0"`
+	Reserve1 string `json:"reserve1"`
+}
+
+func New(chain string, dexConfig config.DexConfig, client rpcpool.Client) dexes.DexAdapter {
+	return &Adapter{
+		chain:     chain,
+		factories: dexConfig.Factories,
+		client:    client,
+	}
+}
+
+func (a *Adapter) Type() string {
+	return Type
+}
+
+func (a *Adapter) Chain() string {
+	return a.chain
+}
+
+func (a *Adapter) DiscoverPools(ctx context.Context, tokens []string, include dexes.PairFilter) []*graph.Pool {
+	var pools []*graph.Pool
+
+	for _, factoryAddr := range a.factories {
+		factory, err := contracts.NewFactory(common.HexToAddress(factoryAddr), a.client)
+		if err != nil {
+			log.Printf("Failed to create factory client: %v", err)
+			continue
+		}
+
+		for i := 0; i < len(tokens); i++ {
+			for j := i + 1; j < len(tokens); j++ {
+				tokenA := common.HexToAddress(tokens[i])
+				tokenB := common.HexToAddress(tokens[j])
+
+				if include != nil && !include(common.HexToAddress(factoryAddr), tokenA, tokenB) {
+					continue
+				}
+
+				if ctx.Err() != nil {
+					return pools
+				}
+
+				pair, err := factory.GetPair(&bind.CallOpts{Context: ctx}, tokenA, tokenB)
+				if err != nil {
+					log.Printf("Failed to get pair: %v", err)
+					continue
+				}
+
+				if pair == (common.Address{}) {
+					continue
+				}
+
+				token0, token1 := sortTokens(tokenA, tokenB)
+				pools = append(pools, &graph.Pool{
+					Token0:  token0.String(),
+					Token1:  token1.String(),
+					Pair:    pair.String(),
+					Factory: factoryAddr,
+					Chain:   a.chain,
+					Dex:     Type,
+				})
+			}
+		}
+	}
+
+	return pools
+}
+
+func (a *Adapter) BuildEdges(ctx context.Context, pool *graph.Pool) (graph.Edge, graph.Edge, error) {
+	lp, err := contracts.NewApp(common.HexToAddress(pool.Pair), a.client)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create pair client: %w", err)
+	}
+
+	reserves, err := lp.GetReserves(&bind.CallOpts{Context: rpcpool.Critical(ctx)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get reserves: %w", err)
+	}
+
+	edge01, edge10 := newEdges(pool, reserves.Reserve0, reserves.Reserve1)
+	return edge01, edge10, nil
+}
+
+func (a *Adapter) Topics() []common.Hash {
+	return []common.Hash{edges.SyncTopic, edges.SwapV2Topic}
+}
+
+// DecodeSwap turns the in and out amounts of a Swap event into net amounts
+// paid into the pair.
+func (a *Adapter) DecodeSwap(vLog types.Log) (dexes.Swap, bool) {
+	if !utils.HasTopics(vLog, edges.SwapV2Topic.Hex()) || len(vLog.Data) < 128 {
+		return dexes.Swap{}, false
+	}
+
+	data := utils.Chunks(common.Bytes2Hex(vLog.Data), 64)
+	amount0In, amount1In := utils.StringToBigInt(data[0]), utils.StringToBigInt(data[1])
+	amount0Out, amount1Out := utils.StringToBigInt(data[2]), utils.StringToBigInt(data[3])
+
+	return dexes.Swap{
+		Amount0: new(big.Int).Sub(amount0In, amount0Out),
+		Amount1: new(big.Int).Sub(amount1In, amount1Out),
+	}, true
+}
+
+func (a *Adapter) ApplyLog(g *graph.Graph, pool *graph.Pool, vLog types.Log) []*graph.PriceSample {
+	return dexes.UpdatePoolEdges(g, pool, vLog)
+}
+
+// PoolBalances returns the reserves of the pair, which Sync keeps equal to its
+// balances.
+func (a *Adapter) PoolBalances(ctx context.Context, g *graph.Graph, pool *graph.Pool) (*big.Int, *big.Int, error) {
+	g.Mu.RLock()
+	defer g.Mu.RUnlock()
+
+	edge, ok := g.GetEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain).(*edges.EVMEdgeV2)
+	if !ok {
+		return nil, nil, fmt.Errorf("pool %s has no V2 edge", pool.Pair)
+	}
+	return edge.Reserve0, edge.Reserve1, nil
+}
+
+// Depth returns the reserves of the pair, all of which back its price.
+func (a *Adapter) Depth(g *graph.Graph, pool *graph.Pool) (*big.Int, *big.Int, bool) {
+	edge, ok := g.GetEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain).(*edges.EVMEdgeV2)
+	if !ok || edge.Reserve0 == nil || edge.Reserve1 == nil {
+		return nil, nil, false
+	}
+	return edge.Reserve0, edge.Reserve1, true
+}
+
+// Fee is the fee every Uniswap V2 pair charges, 0.3%, in hundredths of a
+// basis point.
+const Fee = 3000
+
+// Inspect reports the reserves of the pair, whose ratio is its spot price.
+func (a *Adapter) Inspect(g *graph.Graph, pool *graph.Pool) (dexes.PoolInfo, bool) {
+	edge, ok := g.GetEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain).(*edges.EVMEdgeV2)
+	if !ok || edge.Reserve0 == nil || edge.Reserve1 == nil {
+		return dexes.PoolInfo{}, false
+	}
+
+	info := dexes.PoolInfo{
+		Fee: Fee,
+		State: poolState{
+			Reserve0: edge.Reserve0.String(),
+			Reserve1: edge.Reserve1.String(),
+		},
+	}
+	if edge.Reserve0.Sign() > 0 {
+		info.Price = new(big.Float).Quo(new(big.Float).SetInt(edge.Reserve1), new(big.Float).SetInt(edge.Reserve0))
+	}
+	return info, true
+}
+
+func (a *Adapter) ExportState(g *graph.Graph, pool *graph.Pool) ([]byte, error) {
+	edge, ok := g.GetEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain).(*edges.EVMEdgeV2)
+	if !ok {
+		return nil, fmt.Errorf("pool %s has no V2 edge", pool.Pair)
+	}
+
+	return json.Marshal(poolState{
+		Reserve0: edge.Reserve0.String(),
+		Reserve1: edge.Reserve1.String(),
+	})
+}
+
+func (a *Adapter) ImportState(pool *graph.Pool, data []byte) (graph.Edge, graph.Edge, error) {
+	var state poolState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse V2 pool state: %w", err)
+	}
+
+	reserve0, ok0 := new(big.Int).SetString(state.Reserve0, 10)
+	reserve1, ok1 := new(big.Int).SetString(state.Reserve1, 10)
+	if !ok0 || !ok1 {
+		return nil, nil, fmt.Errorf("invalid reserves in V2 pool state")
+	}
+
+	edge01, edge10 := newEdges(pool, reserve0, reserve1)
+	return edge01, edge10, nil
+}
+
+func newEdges(pool *graph.Pool, reserve0, reserve1 *big.Int) (graph.Edge, graph.Edge) {
+	token0 := common.HexToAddress(pool.Token0)
+	token1 := common.HexToAddress(pool.Token1)
+
+	edge01 := &edges.EVMEdgeV2{
+		Token0:     token0,
+		Token1:     token1,
+		Reserve0:   reserve0,
+		Reserve1:   reserve1,
+		ZeroForOne: true,
+	}
+	edge10 := &edges.EVMEdgeV2{
+		Token0:     token1,
+		Token1:     token0,
+		Reserve0:   reserve1,
+		Reserve1:   reserve0,
+		ZeroForOne: false,
+	}
+
+	return edge01, edge10
+}
+
+func sortTokens(tokenA, tokenB common.Address) (common.Address, common.Address) {
+	if bytes.Compare(tokenA.Bytes(), tokenB.Bytes()) < 0 {
+		return tokenA, tokenB
+	}
+	return tokenB, tokenA
+}
@@ -0,0 +1,347 @@
+package uniswapv3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"slices"
+	"sort"
+
+	"dumb-api/config"
+	"dumb-api/internal/contracts"
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/graph/edges"
+	"dumb-api/internal/rpcpool"
+	"dumb-api/internal/utils"
+
+	"github.com/daoleno/uniswapv3-sdk/constants"
+	"github.com/daoleno/uniswapv3-sdk/entities"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Type is the name Uniswap V3 style entries use in evm_config.json.
+const Type = "uniswapV3"
+
+func init() {
+	dexes.Register(Type, New)
+}
+
+// Adapter discovers and tracks concentrated liquidity pools created by a set
+// of Uniswap V3 compatible factories.
+type Adapter struct {
+	chain     string
+	factories []string
+	feeTiers  []string
+	client    rpcpool.Client
+}
+
+type tickState struct {
+	Index          int    `json:"index"`
+	LiquidityGross string `json:"liquidityGross"`
+	LiquidityNet   string `json:"liquidityNet"`
+}
+
+type poolState struct {
+	SqrtPriceX96 string      `json:"sqrtPriceX96"`
+	Liquidity    string      `json:"liquidity"`
+	Tick         int         `json:"tick"`
+	Fee          uint32      `json:"fee"`
+	Ticks        []tickState `json:"ticks"`
+}
+
+// spotState is the part of poolState the current price derives from.
+type spotState struct {
+	SqrtPriceX96 string `json:"sqrtPriceX96"`
+	Liquidity    string `json:"liquidity"`
+	Tick         int    `json:"tick"`
+}
+
+func New(chain string, dexConfig config.DexConfig, client rpcpool.Client) dexes.DexAdapter {
+	feeTiers := dexConfig.FeeTiers
+	if len(feeTiers) == 0 {
+		feeTiers = config.FeeTiers
+	}
+
+	return &Adapter{
+		chain:     chain,
+		factories: dexConfig.Factories,
+		feeTiers:  feeTiers,
+		client:    client,
+	}
+}
+
+func (a *Adapter) Type() string {
+	return Type
+}
+
+func (a *Adapter) Chain() string {
+	return a.chain
+}
+
+func (a *Adapter) DiscoverPools(ctx context.Context, tokens []string, include dexes.PairFilter) []*graph.Pool {
+	var pools []*graph.Pool
+
+	for _, factoryAddr := range a.factories {
+		factory, err := contracts.NewContracts(common.HexToAddress(factoryAddr), a.client)
+		if err != nil {
+			log.Printf("Failed to create factory client: %v", err)
+			continue
+		}
+
+		for i := 0; i < len(tokens); i++ {
+			for j := i + 1; j < len(tokens); j++ {
+				tokenA := common.HexToAddress(tokens[i])
+				tokenB := common.HexToAddress(tokens[j])
+
+				if include != nil && !include(common.HexToAddress(factoryAddr), tokenA, tokenB) {
+					continue
+				}
+
+				for _, feeTierStr := range a.feeTiers {
+					if ctx.Err() != nil {
+						return pools
+					}
+
+					feeTier, ok := new(big.Int).SetString(feeTierStr, 10)
+					if !ok {
+						log.Printf("Failed to convert fee tier: %v", feeTierStr)
+						continue
+					}
+
+					callOpts := &bind.CallOpts{
+						Pending: false,
+						Context: ctx,
+					}
+
+					pair, err := factory.GetPool(callOpts, tokenA, tokenB, feeTier)
+					if err != nil {
+						log.Printf("Failed to get pair: %v", err)
+						continue
+					}
+
+					if pair == (common.Address{}) {
+						log.Printf("No pool found for tokens %s and %s with fee tier %s", tokenA.String(), tokenB.String(), feeTierStr)
+						continue
+					}
+
+					token0, token1 := sortTokens(tokenA, tokenB)
+					pools = append(pools, &graph.Pool{
+						Token0:  token0.String(),
+						Token1:  token1.String(),
+						Pair:    pair.String(),
+						Factory: factoryAddr,
+						Chain:   a.chain,
+						Dex:     Type,
+					})
+				}
+			}
+		}
+	}
+
+	return pools
+}
+
+func (a *Adapter) BuildEdges(ctx context.Context, pool *graph.Pool) (graph.Edge, graph.Edge, error) {
+	return loadPool(ctx, common.HexToAddress(pool.Pair), a.client)
+}
+
+// Topics include Mint and Burn, which move the liquidity of the ticks the
+// swap simulation crosses.
+func (a *Adapter) Topics() []common.Hash {
+	return []common.Hash{edges.SwapV3Topic, edges.MintV3Topic, edges.BurnV3Topic}
+}
+
+// DecodeSwap reads the signed amounts of a Swap event, which are already
+// relative to the pool.
+func (a *Adapter) DecodeSwap(vLog types.Log) (dexes.Swap, bool) {
+	if !utils.HasTopics(vLog, edges.SwapV3Topic.Hex()) || len(vLog.Data) < 64 {
+		return dexes.Swap{}, false
+	}
+
+	data := utils.Chunks(common.Bytes2Hex(vLog.Data), 64)
+	return dexes.Swap{
+		Amount0: utils.StringToBigInt(data[0]),
+		Amount1: utils.StringToBigInt(data[1]),
+	}, true
+}
+
+func (a *Adapter) ApplyLog(g *graph.Graph, pool *graph.Pool, vLog types.Log) []*graph.PriceSample {
+	return dexes.UpdatePoolEdges(g, pool, vLog)
+}
+
+// PoolBalances reads the token balances of the pool, which unlike its
+// liquidity include the amounts held by positions out of range.
+func (a *Adapter) PoolBalances(ctx context.Context, g *graph.Graph, pool *graph.Pool) (*big.Int, *big.Int, error) {
+	pair := common.HexToAddress(pool.Pair)
+	balance0, err := contracts.BalanceOf(ctx, a.client, common.HexToAddress(pool.Token0), pair)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get token0 balance: %w", err)
+	}
+	balance1, err := contracts.BalanceOf(ctx, a.client, common.HexToAddress(pool.Token1), pair)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get token1 balance: %w", err)
+	}
+	return balance0, balance1, nil
+}
+
+// Depth returns the virtual reserves of the in-range liquidity, L/sqrtP of
+// token0 and L*sqrtP of token1.
+func (a *Adapter) Depth(g *graph.Graph, pool *graph.Pool) (*big.Int, *big.Int, bool) {
+	edge, ok := g.GetEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain).(*edges.EVMEdgeV3)
+	if !ok || edge.Liquidity == nil || edge.SqrtRatioX96 == nil || edge.SqrtRatioX96.Sign() == 0 {
+		return nil, nil, false
+	}
+
+	reserve0 := new(big.Int).Lsh(edge.Liquidity, 96)
+	reserve0.Quo(reserve0, edge.SqrtRatioX96)
+	reserve1 := new(big.Int).Mul(edge.Liquidity, edge.SqrtRatioX96)
+	reserve1.Rsh(reserve1, 96)
+	return reserve0, reserve1, true
+}
+
+// Inspect reports the sqrt price, tick and in-range liquidity of the pool.
+// The spot price is the square of the sqrt price.
+func (a *Adapter) Inspect(g *graph.Graph, pool *graph.Pool) (dexes.PoolInfo, bool) {
+	edge, ok := g.GetEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain).(*edges.EVMEdgeV3)
+	if !ok || edge.SqrtRatioX96 == nil || edge.Liquidity == nil {
+		return dexes.PoolInfo{}, false
+	}
+
+	info := dexes.PoolInfo{
+		Fee: uint32(edge.Fee),
+		State: spotState{
+			SqrtPriceX96: edge.SqrtRatioX96.String(),
+			Liquidity:    edge.Liquidity.String(),
+			Tick:         edge.TickCurrent,
+		},
+	}
+	if edge.SqrtRatioX96.Sign() > 0 {
+		sqrtPrice := new(big.Float).SetInt(edge.SqrtRatioX96)
+		sqrtPrice.Quo(sqrtPrice, new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1), 96)))
+		info.Price = sqrtPrice.Mul(sqrtPrice, sqrtPrice)
+	}
+	return info, true
+}
+
+// Liquidity walks the initialized ticks of the pool outwards from the current
+// tick, crossing each one as a swap would, to find the liquidity active
+// between every pair of neighbouring ticks.
+func (a *Adapter) Liquidity(g *graph.Graph, pool *graph.Pool) (dexes.LiquidityDistribution, bool) {
+	edge, ok := g.GetEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain).(*edges.EVMEdgeV3)
+	if !ok || edge.SqrtRatioX96 == nil || edge.Liquidity == nil {
+		return dexes.LiquidityDistribution{}, false
+	}
+
+	ticks := edge.Ticks
+	distribution := dexes.LiquidityDistribution{
+		Tick:         edge.TickCurrent,
+		SqrtPriceX96: edge.SqrtRatioX96,
+		Liquidity:    edge.Liquidity,
+	}
+
+	// ticks[:k] are at or below the current tick.
+	k := sort.Search(len(ticks), func(i int) bool { return ticks[i].Index > edge.TickCurrent })
+
+	// Moving down across a tick removes the liquidity it added.
+	liquidity := edge.Liquidity
+	for i := k - 1; i > 0; i-- {
+		liquidity = new(big.Int).Sub(liquidity, ticks[i].LiquidityNet)
+		distribution.Ranges = append(distribution.Ranges, dexes.LiquidityRange{
+			TickLower: ticks[i-1].Index,
+			TickUpper: ticks[i].Index,
+			Liquidity: liquidity,
+		})
+	}
+	slices.Reverse(distribution.Ranges)
+
+	if k > 0 && k < len(ticks) {
+		distribution.Ranges = append(distribution.Ranges, dexes.LiquidityRange{
+			TickLower: ticks[k-1].Index,
+			TickUpper: ticks[k].Index,
+			Liquidity: edge.Liquidity,
+		})
+	}
+
+	liquidity = edge.Liquidity
+	for i := k; i < len(ticks)-1; i++ {
+		liquidity = new(big.Int).Add(liquidity, ticks[i].LiquidityNet)
+		distribution.Ranges = append(distribution.Ranges, dexes.LiquidityRange{
+			TickLower: ticks[i].Index,
+			TickUpper: ticks[i+1].Index,
+			Liquidity: liquidity,
+		})
+	}
+
+	return distribution, true
+}
+
+func (a *Adapter) ExportState(g *graph.Graph, pool *graph.Pool) ([]byte, error) {
+	edge, ok := g.GetEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain).(*edges.EVMEdgeV3)
+	if !ok {
+		return nil, fmt.Errorf("pool %s has no V3 edge", pool.Pair)
+	}
+
+	state := poolState{
+		SqrtPriceX96: edge.SqrtRatioX96.String(),
+		Liquidity:    edge.Liquidity.String(),
+		Tick:         edge.TickCurrent,
+		Fee:          uint32(edge.Fee),
+		Ticks:        make([]tickState, len(edge.Ticks)),
+	}
+	for i, tick := range edge.Ticks {
+		state.Ticks[i] = tickState{
+			Index:          tick.Index,
+			LiquidityGross: tick.LiquidityGross.String(),
+			LiquidityNet:   tick.LiquidityNet.String(),
+		}
+	}
+
+	return json.Marshal(state)
+}
+
+func (a *Adapter) ImportState(pool *graph.Pool, data []byte) (graph.Edge, graph.Edge, error) {
+	var state poolState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse V3 pool state: %w", err)
+	}
+
+	sqrtPriceX96, ok0 := new(big.Int).SetString(state.SqrtPriceX96, 10)
+	liquidity, ok1 := new(big.Int).SetString(state.Liquidity, 10)
+	if !ok0 || !ok1 {
+		return nil, nil, fmt.Errorf("invalid price or liquidity in V3 pool state")
+	}
+
+	ticks := make([]entities.Tick, len(state.Ticks))
+	for i, tick := range state.Ticks {
+		liquidityGross, ok0 := new(big.Int).SetString(tick.LiquidityGross, 10)
+		liquidityNet, ok1 := new(big.Int).SetString(tick.LiquidityNet, 10)
+		if !ok0 || !ok1 {
+			return nil, nil, fmt.Errorf("invalid tick %d in V3 pool state", tick.Index)
+		}
+		ticks[i] = entities.Tick{
+			Index:          tick.Index,
+			LiquidityGross: liquidityGross,
+			LiquidityNet:   liquidityNet,
+		}
+	}
+
+	token0 := common.HexToAddress(pool.Token0)
+	token1 := common.HexToAddress(pool.Token1)
+	fee := constants.FeeAmount(state.Fee)
+
+	edge01, err := newEdge(token0, token1, fee, sqrtPriceX96, liquidity, state.Tick, ticks)
+	if err != nil {
+		return nil, nil, err
+	}
+	edge10, err := newEdge(token1, token0, fee, sqrtPriceX96, liquidity, state.Tick, ticks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return edge01, edge10, nil
+}
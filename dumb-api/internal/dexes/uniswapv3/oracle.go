@@ -0,0 +1,71 @@
+package uniswapv3
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"dumb-api/internal/contracts"
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// secondsPerLiquidityModulus wraps the uint160 seconds per liquidity
+// accumulator, which is allowed to overflow.
+var secondsPerLiquidityModulus = new(big.Int).Lsh(big.NewInt(1), 160)
+
+// Observe reads the tick and seconds per liquidity accumulators of the pool
+// window ago and now, and derives the mean tick and harmonic mean liquidity
+// the way OracleLibrary.consult does. The call reverts when the pool's
+// observation cardinality does not cover window.
+func (a *Adapter) Observe(ctx context.Context, pool *graph.Pool, window time.Duration) (dexes.Observation, error) {
+	seconds := int64(window / time.Second)
+	if seconds <= 0 || seconds > int64(^uint32(0)) {
+		return dexes.Observation{}, fmt.Errorf("invalid window %s", window)
+	}
+
+	lp, err := contracts.NewPoolV3(common.HexToAddress(pool.Pair), a.client)
+	if err != nil {
+		return dexes.Observation{}, fmt.Errorf("failed to create pool client: %w", err)
+	}
+
+	observed, err := lp.Observe(&bind.CallOpts{Context: ctx}, []uint32{uint32(seconds), 0})
+	if err != nil {
+		return dexes.Observation{}, fmt.Errorf("failed to observe pool %s: %w", pool.Pair, err)
+	}
+	if len(observed.TickCumulatives) != 2 || len(observed.SecondsPerLiquidityCumulativeX128s) != 2 {
+		return dexes.Observation{}, fmt.Errorf("invalid observation of pool %s", pool.Pair)
+	}
+
+	return consult(observed.TickCumulatives, observed.SecondsPerLiquidityCumulativeX128s, seconds), nil
+}
+
+// consult derives the mean tick and harmonic mean liquidity over the seconds
+// between the first and second reading of the tick and seconds per liquidity
+// accumulators.
+func consult(tickCumulatives, secondsPerLiquidityCumulativeX128s []*big.Int, seconds int64) dexes.Observation {
+	// The mean tick rounds towards negative infinity.
+	period := big.NewInt(seconds)
+	tickDelta := new(big.Int).Sub(tickCumulatives[1], tickCumulatives[0])
+	meanTick, remainder := new(big.Int).QuoRem(tickDelta, period, new(big.Int))
+	if tickDelta.Sign() < 0 && remainder.Sign() != 0 {
+		meanTick.Sub(meanTick, big.NewInt(1))
+	}
+
+	liquidityDelta := new(big.Int).Sub(secondsPerLiquidityCumulativeX128s[1], secondsPerLiquidityCumulativeX128s[0])
+	liquidityDelta.Mod(liquidityDelta, secondsPerLiquidityModulus)
+	harmonicMeanLiquidity := new(big.Int)
+	if liquidityDelta.Sign() > 0 {
+		harmonicMeanLiquidity.Lsh(period, 128)
+		harmonicMeanLiquidity.Quo(harmonicMeanLiquidity, liquidityDelta)
+	}
+
+	return dexes.Observation{
+		MeanTick:              int(meanTick.Int64()),
+		HarmonicMeanLiquidity: harmonicMeanLiquidity,
+	}
+}
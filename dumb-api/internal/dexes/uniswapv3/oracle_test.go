@@ -0,0 +1,48 @@
+package uniswapv3
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestConsult(t *testing.T) {
+	// Over 600 seconds, a seconds per liquidity increase of 600<<108 is a
+	// harmonic mean liquidity of 1<<20.
+	perLiquidity := new(big.Int).Lsh(big.NewInt(600), 108)
+	wrapped := new(big.Int).Sub(secondsPerLiquidityModulus, new(big.Int).Lsh(big.NewInt(300), 108))
+	half := new(big.Int).Lsh(big.NewInt(300), 108)
+
+	tests := []struct {
+		name          string
+		ticks         [2]int64
+		perLiquidity  [2]*big.Int
+		seconds       int64
+		meanTick      int
+		meanLiquidity *big.Int
+	}{
+		{"positive exact", [2]int64{0, 60000}, [2]*big.Int{big.NewInt(0), perLiquidity}, 600, 100, big.NewInt(1 << 20)},
+		{"positive rounds down", [2]int64{1000, 1601}, [2]*big.Int{big.NewInt(0), perLiquidity}, 600, 1, big.NewInt(1 << 20)},
+		{"negative exact", [2]int64{0, -60000}, [2]*big.Int{big.NewInt(0), perLiquidity}, 600, -100, big.NewInt(1 << 20)},
+		{"negative rounds towards negative infinity", [2]int64{0, -601}, [2]*big.Int{big.NewInt(0), perLiquidity}, 600, -2, big.NewInt(1 << 20)},
+		{"negative accumulators", [2]int64{-1000, -1601}, [2]*big.Int{big.NewInt(0), perLiquidity}, 600, -2, big.NewInt(1 << 20)},
+		{"negative below one tick", [2]int64{0, -1}, [2]*big.Int{big.NewInt(0), perLiquidity}, 600, -1, big.NewInt(1 << 20)},
+		{"seconds per liquidity wraps", [2]int64{0, 0}, [2]*big.Int{wrapped, half}, 600, 0, big.NewInt(1 << 20)},
+		{"no liquidity change", [2]int64{0, 0}, [2]*big.Int{perLiquidity, perLiquidity}, 600, 0, big.NewInt(0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observation := consult(
+				[]*big.Int{big.NewInt(tt.ticks[0]), big.NewInt(tt.ticks[1])},
+				tt.perLiquidity[:],
+				tt.seconds,
+			)
+			if observation.MeanTick != tt.meanTick {
+				t.Errorf("mean tick is %d, want %d", observation.MeanTick, tt.meanTick)
+			}
+			if observation.HarmonicMeanLiquidity.Cmp(tt.meanLiquidity) != 0 {
+				t.Errorf("harmonic mean liquidity is %s, want %s", observation.HarmonicMeanLiquidity, tt.meanLiquidity)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package uniswapv3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"dumb-api/internal/contracts"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/graph/edges"
+	"dumb-api/internal/rpcpool"
+	"dumb-api/internal/utils"
+	"dumb-api/models"
+
+	"github.com/daoleno/uniswapv3-sdk/constants"
+	"github.com/daoleno/uniswapv3-sdk/entities"
+	uniswapv3utils "github.com/daoleno/uniswapv3-sdk/utils"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+)
+
+// TickCacheTTL is how long the ticks cached for a pool are trusted. Running
+// listeners keep the ticks of the graph current by applying Mint and Burn
+// logs, but the cache only holds the ticks read when the pool was loaded.
+const TickCacheTTL = 6 * time.Hour
+
+func newEdge(tokenA, tokenB common.Address, fee constants.FeeAmount, sqrtRatioX96, liquidity *big.Int, tickCurrent int, ticks []entities.Tick) (graph.Edge, error) {
+	if fee >= constants.FeeMax {
+		return nil, nil
+	}
+
+	token0, token1 := tokenA, tokenB
+	isSorted := bytes.Compare(tokenA.Bytes(), tokenB.Bytes()) < 0
+	if !isSorted {
+		token0, token1 = tokenB, tokenA
+	}
+
+	provider, err := entities.NewTickListDataProvider(ticks, constants.TickSpacings[fee])
+	if err != nil {
+		return nil, fmt.Errorf("invalid tick list: %w", err)
+	}
+
+	return &edges.EVMEdgeV3{
+		Token0:           token0,
+		Token1:           token1,
+		SqrtRatioX96:     sqrtRatioX96,
+		Liquidity:        liquidity,
+		TickCurrent:      tickCurrent,
+		Ticks:            ticks,
+		TickDataProvider: provider,
+		ZeroForOne:       isSorted,
+		Fee:              fee,
+	}, nil
+}
+
+// loadPool reads slot0, liquidity and the initialized ticks of a pool and
+// returns its token0->token1 and token1->token0 edges. Ticks are cached in
+// the ticks table since scanning the bitmap takes thousands of calls, and
+// read again once the cache is older than TickCacheTTL. The cache holds the
+// latest ticks, so it is bypassed when ctx pins calls to a past block.
+func loadPool(ctx context.Context, pairAddr common.Address, client rpcpool.Client) (graph.Edge, graph.Edge, error) {
+	opts := &bind.CallOpts{Context: ctx}
+	_, pinned := rpcpool.PinnedBlock(ctx)
+
+	lp, err := contracts.NewPoolV3(pairAddr, client)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create pool client: %w", err)
+	}
+
+	token0, err := lp.Token0(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get token0: %w", err)
+	}
+
+	token1, err := lp.Token1(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get token1: %w", err)
+	}
+
+	fee, err := lp.Fee(opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get fee: %w", err)
+	}
+
+	uintFee := constants.FeeAmount(fee.Uint64())
+	tickSpacing := constants.TickSpacings[uintFee]
+
+	if tickSpacing == 0 {
+		return nil, nil, fmt.Errorf("unsupported fee tier %d", uintFee)
+	}
+
+	// Price and liquidity seed the edges every later log builds on, so they
+	// are read through the provider quorum when one is configured.
+	critical := &bind.CallOpts{Context: rpcpool.Critical(ctx)}
+
+	slot0, err := lp.Slot0(critical)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get slot0: %w", err)
+	}
+
+	liquidity, err := lp.Liquidity(critical)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get liquidity: %w", err)
+	}
+
+	currentTick := int(slot0.Tick.Int64())
+
+	var ticks []entities.Tick
+	var dbTicks []models.Tick
+
+	if !pinned {
+		err = models.DB.Where("pool_address = ?", pairAddr.String()).Order("tick_index asc").All(&dbTicks)
+	}
+	if !pinned && err == nil && len(dbTicks) > 0 && fresh(dbTicks) {
+		for _, dbTick := range dbTicks {
+			ticks = append(ticks, entities.Tick{
+				Index:          dbTick.Index,
+				LiquidityGross: dbTick.GetLiquidityGross(),
+				LiquidityNet:   dbTick.GetLiquidityNet(),
+			})
+		}
+	} else {
+		ticks, err = fetchTicks(ctx, lp, pairAddr, tickSpacing, !pinned)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	edge01, err := newEdge(token0, token1, uintFee, slot0.SqrtPriceX96, liquidity, currentTick, ticks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	edge10, err := newEdge(token1, token0, uintFee, slot0.SqrtPriceX96, liquidity, currentTick, ticks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return edge01, edge10, nil
+}
+
+// fetchTicks scans the tick bitmap of a pool and reads every initialized
+// tick, saving them to the ticks table when cache is set.
+func fetchTicks(ctx context.Context, lp *contracts.PoolV3, pairAddr common.Address, tickSpacing int, cache bool) ([]entities.Tick, error) {
+	opts := &bind.CallOpts{Context: ctx}
+
+	minWord := utils.TickToWord(uniswapv3utils.MinTick, tickSpacing)
+	maxWord := utils.TickToWord(uniswapv3utils.MaxTick, tickSpacing)
+
+	wordPosIndices := make([]int, 0)
+	results := make([]*big.Int, 0)
+	i := minWord
+	for i <= maxWord {
+		bitmapRes, err := lp.TickBitmap(opts, int16(i))
+		if err != nil {
+			log.Printf("Error fetching TickBitmap, retrying after sleep: %v", err)
+			if err := sleep(ctx, 2*time.Second); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		wordPosIndices = append(wordPosIndices, i)
+		results = append(results, bitmapRes)
+		if err := sleep(ctx, 250*time.Millisecond); err != nil {
+			return nil, err
+		}
+		i++
+	}
+
+	tickIndices := make([]int, 0)
+
+	for j := 0; j < len(wordPosIndices); j++ {
+		ind := wordPosIndices[j]
+		bitmap := results[j]
+
+		if bitmap.Cmp(big.NewInt(0)) != 0 {
+			for i := 0; i < 256; i++ {
+				bit := big.NewInt(1)
+				initialized := new(big.Int).And(bitmap, new(big.Int).Lsh(bit, uint(i))).Cmp(big.NewInt(0)) != 0
+				if initialized {
+					tickIndex := (ind*256 + i) * tickSpacing
+					tickIndices = append(tickIndices, tickIndex)
+				}
+			}
+		}
+	}
+
+	var ticks []entities.Tick
+	var dbTicks []models.Tick
+	now := time.Now()
+	for _, t := range tickIndices {
+		tickData, err := lp.Ticks(opts, big.NewInt(int64(t)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tick %d: %w", t, err)
+		}
+
+		ticks = append(ticks, entities.Tick{
+			Index:          t,
+			LiquidityGross: tickData.LiquidityGross,
+			LiquidityNet:   tickData.LiquidityNet,
+		})
+
+		dbTick := models.Tick{
+			ID:          uuid.Must(uuid.NewV4()),
+			PoolAddress: pairAddr.String(),
+			Index:       t,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		dbTick.SetLiquidityGross(tickData.LiquidityGross)
+		dbTick.SetLiquidityNet(tickData.LiquidityNet)
+		dbTicks = append(dbTicks, dbTick)
+	}
+
+	if cache {
+		// The cached ticks are replaced as a whole so ticks uninitialized
+		// since the last read do not linger.
+		err := models.DB.Transaction(func(tx *pop.Connection) error {
+			if err := tx.RawQuery("DELETE FROM ticks WHERE pool_address = ?", pairAddr.String()).Exec(); err != nil {
+				return err
+			}
+			for i := range dbTicks {
+				if err := tx.Create(&dbTicks[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error saving ticks of pool %s to database: %v", pairAddr.String(), err)
+		}
+	}
+
+	return ticks, nil
+}
+
+// fresh reports whether the cached ticks of a pool were all read within
+// TickCacheTTL.
+func fresh(dbTicks []models.Tick) bool {
+	for _, dbTick := range dbTicks {
+		if time.Since(dbTick.UpdatedAt) > TickCacheTTL {
+			return false
+		}
+	}
+	return true
+}
+
+func sortTokens(tokenA, tokenB common.Address) (common.Address, common.Address) {
+	if bytes.Compare(tokenA.Bytes(), tokenB.Bytes()) < 0 {
+		return tokenA, tokenB
+	}
+	return tokenB, tokenA
+}
+
+// sleep waits for d, returning early with the context's error when ctx is
+// cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
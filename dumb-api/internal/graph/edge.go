@@ -2,14 +2,38 @@ package graph
 
 import (
 	"math/big"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 )
 
 type Edge interface {
-	UpdateEdge(vLog types.Log, chainID string)
+	// UpdateEdge applies vLog to the edge and returns the sample of the price
+	// it quotes afterwards, or nil when the log did not move it.
+	UpdateEdge(vLog types.Log, chainID string) *PriceSample
 	ComputeExactAmountOut(amountIn *big.Int) *big.Int
 	ComputePriceImpact(amountIn *big.Int) *big.Float
 	Export() []string
 	Copy() Edge
 	GetWeight() *big.Float
 }
+
+// Bridge is an edge that moves a token from one chain to another. Routes
+// only take it when the amount is held on its source chain.
+type Bridge interface {
+	Edge
+	Chains() (from, to string)
+}
+
+// PriceSample is the state of an edge right after a log was applied to it,
+// kept so the price tick of the log can be computed and stored once the graph
+// is unlocked.
+type PriceSample struct {
+	// Edge is a copy of the edge, which later logs do not change.
+	Edge     Edge
+	Log      types.Log
+	Chain    string
+	TokenIn  common.Address
+	TokenOut common.Address
+	// Volume is the amount of TokenIn the log moved, nil when unknown.
+	Volume *big.Int
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"math/big"
 
+	"dumb-api/config"
 	"dumb-api/internal/graph"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -14,10 +15,14 @@ import (
 type BridgeEdge struct {
 	Token0 common.Address
 	Token1 common.Address
+	// FromChain and ToChain are the chains Token0 is sent from and Token1 is
+	// received on.
+	FromChain string
+	ToChain   string
 }
 
-func (e *BridgeEdge) UpdateEdge(pendingLog types.Log, chainID string) {
-
+func (e *BridgeEdge) UpdateEdge(pendingLog types.Log, chainID string) *graph.PriceSample {
+	return nil
 }
 
 func (e *BridgeEdge) ComputeExactAmountOut(amountIn *big.Int) *big.Int {
@@ -49,11 +54,66 @@ func (e *BridgeEdge) Export() []string {
 
 func (e *BridgeEdge) Copy() graph.Edge {
 	return &BridgeEdge{
-		Token0: e.Token0,
-		Token1: e.Token1,
+		Token0:    e.Token0,
+		Token1:    e.Token1,
+		FromChain: e.FromChain,
+		ToChain:   e.ToChain,
 	}
 }
 
+func (e *BridgeEdge) Chains() (string, string) {
+	return e.FromChain, e.ToChain
+}
+
 func (e *BridgeEdge) GetWeight() *big.Float {
 	return big.NewFloat(0)
 }
+
+// AddBridges adds the edges of the USDC bridge between Avalanche and Coqnet to
+// g, when both chains are configured.
+func AddBridges(g *graph.Graph) {
+	avalanche, okAvalanche := config.GetChainConfig("AVALANCHE")
+	coqnet, okCoqnet := config.GetChainConfig("COQNET")
+	if !okAvalanche || !okCoqnet {
+		return
+	}
+
+	usdcAvalanche := avalanche.Tokens[0].Address
+	usdcCoq := coqnet.Tokens[0].Address
+
+	bridgeEdge01 := BridgeEdge{
+		Token0:    common.HexToAddress(usdcAvalanche),
+		Token1:    common.HexToAddress(usdcCoq),
+		FromChain: "avalanche",
+		ToChain:   "coqnet",
+	}
+
+	bridgeEdge10 := BridgeEdge{
+		Token0:    common.HexToAddress(usdcCoq),
+		Token1:    common.HexToAddress(usdcAvalanche),
+		FromChain: "coqnet",
+		ToChain:   "avalanche",
+	}
+
+	g.NewEdge(usdcAvalanche, usdcCoq, "pool", "coqnet", &bridgeEdge01)
+	g.NewEdge(usdcCoq, usdcAvalanche, "pool1", "avalanche", &bridgeEdge10)
+}
+
+// RemoveBridges deletes every bridge edge from g, so AddBridges can rebuild
+// them after the tokens they connect changed.
+func RemoveBridges(g *graph.Graph) {
+	for _, tos := range g.Edges {
+		for _, pools := range tos {
+			for pool, chains := range pools {
+				for chain, edge := range chains {
+					if _, ok := edge.(*BridgeEdge); ok {
+						delete(chains, chain)
+					}
+				}
+				if len(chains) == 0 {
+					delete(pools, pool)
+				}
+			}
+		}
+	}
+}
@@ -4,17 +4,23 @@ import (
 	"encoding/json"
 	"log"
 	"math/big"
-	"time"
 
-	"dumb-api/config"
 	"dumb-api/internal/graph"
 	"dumb-api/internal/utils"
-	"dumb-api/models"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
+// SyncTopic is the topic of the Sync(uint112,uint112) event emitted by V2 pairs.
+var SyncTopic = crypto.Keccak256Hash([]byte("Sync(uint112,uint112)"))
+
+// SwapV2Topic is the topic of the Swap(address,uint256,uint256,uint256,uint256,address)
+// event emitted by V2 pairs. It does not change reserves, which are always
+// followed by a Sync, but carries the amounts traded.
+var SwapV2Topic = crypto.Keccak256Hash([]byte("Swap(address,uint256,uint256,uint256,uint256,address)"))
+
 type EVMEdgeV2 struct {
 	Token0     common.Address
 	Token1     common.Address
@@ -23,10 +29,10 @@ type EVMEdgeV2 struct {
 	ZeroForOne bool
 }
 
-func (e *EVMEdgeV2) UpdateEdge(pendingLog types.Log, chainID string) {
+func (e *EVMEdgeV2) UpdateEdge(pendingLog types.Log, chainID string) *graph.PriceSample {
 
-	if !utils.HasTopics(pendingLog, config.SyncTopic) {
-		return
+	if !utils.HasTopics(pendingLog, SyncTopic.Hex()) {
+		return nil
 	}
 
 	data := utils.Chunks(common.Bytes2Hex(pendingLog.Data), 64)
@@ -42,25 +48,9 @@ func (e *EVMEdgeV2) UpdateEdge(pendingLog types.Log, chainID string) {
 		e.Reserve1 = reserve0
 	}
 
-	amountOut := e.ComputeExactAmountOut(config.AmountIn)
-
-	if amountOut == nil {
-		log.Printf("[DELPHI] Nil AmountOut, Token0: %s, Token1: %s", e.Token0, e.Token1)
-	}
-
-	priceTick := &models.PriceTick{
-		TokenIn:   e.Token0.String(),
-		TokenOut:  e.Token1.String(),
-		Chain:     chainID,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-
-	err := models.DB.Create(priceTick)
-	if err != nil {
-		log.Printf("[DELPHI] Err creating price tick V2: %v", err)
-	}
-
+	// Sync does not tell swaps from liquidity changes, so V2 ticks carry
+	// no volume.
+	return sample(e, pendingLog, chainID, e.Token0, e.Token1, nil)
 }
 
 func (e *EVMEdgeV2) ComputeExactAmountOut(amountIn *big.Int) *big.Int {
@@ -5,18 +5,28 @@ import (
 	"errors"
 	"log"
 	"math/big"
-	"time"
+	"sort"
 
 	"dumb-api/config"
 	"dumb-api/internal/graph"
 	"dumb-api/internal/utils"
-	"dumb-api/models"
 
 	"github.com/daoleno/uniswapv3-sdk/constants"
 	"github.com/daoleno/uniswapv3-sdk/entities"
 	uniswapv3utils "github.com/daoleno/uniswapv3-sdk/utils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SwapV3Topic is the topic of the Swap event emitted by V3 pools.
+var SwapV3Topic = crypto.Keccak256Hash([]byte("Swap(address,address,int256,int256,uint160,uint128,int24)"))
+
+// MintV3Topic and BurnV3Topic are the topics of the events V3 pools emit when
+// a position adds or removes liquidity between two ticks.
+var (
+	MintV3Topic = crypto.Keccak256Hash([]byte("Mint(address,address,int24,int24,uint128,uint256,uint256)"))
+	BurnV3Topic = crypto.Keccak256Hash([]byte("Burn(address,int24,int24,uint128,uint256,uint256)"))
 )
 
 var (
@@ -41,6 +51,7 @@ type EVMEdgeV3 struct {
 	SqrtRatioX96     *big.Int
 	Liquidity        *big.Int
 	TickCurrent      int
+	Ticks            []entities.Tick
 	TickDataProvider entities.TickDataProvider
 	ZeroForOne       bool
 	exchangeRate     *big.Float
@@ -54,15 +65,20 @@ func (e *EVMEdgeV3) Copy() graph.Edge {
 		SqrtRatioX96:     e.SqrtRatioX96,
 		Liquidity:        e.Liquidity,
 		TickCurrent:      e.TickCurrent,
+		Ticks:            e.Ticks,
 		TickDataProvider: e.TickDataProvider,
 		ZeroForOne:       e.ZeroForOne,
 		exchangeRate:     e.exchangeRate,
 	}
 }
 
-func (e *EVMEdgeV3) UpdateEdge(pendingLog types.Log, chainID string) {
-	if !utils.HasTopics(pendingLog, config.SwapV3Topic) {
-		return
+func (e *EVMEdgeV3) UpdateEdge(pendingLog types.Log, chainID string) *graph.PriceSample {
+	if utils.HasTopics(pendingLog, MintV3Topic.Hex(), BurnV3Topic.Hex()) {
+		e.updateLiquidity(pendingLog)
+		return nil
+	}
+	if !utils.HasTopics(pendingLog, SwapV3Topic.Hex()) {
+		return nil
 	}
 
 	data := utils.Chunks(common.Bytes2Hex(pendingLog.Data), 64)
@@ -82,19 +98,92 @@ func (e *EVMEdgeV3) UpdateEdge(pendingLog types.Log, chainID string) {
 
 	e.exchangeRate = new(big.Float).Quo(new(big.Float).SetInt(amountOut), new(big.Float).SetInt(config.AmountIn))
 
-	priceTick := &models.PriceTick{
-		TokenIn:   e.Token0.String(),
-		TokenOut:  e.Token1.String(),
-		Chain:     chainID,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	// Token0 and Token1 are sorted, the direction of the edge is ZeroForOne.
+	tokenIn, tokenOut := e.Token0, e.Token1
+	volume := utils.StringToBigInt(data[0])
+	if !e.ZeroForOne {
+		tokenIn, tokenOut = tokenOut, tokenIn
+		volume = utils.StringToBigInt(data[1])
 	}
+	return sample(e, pendingLog, chainID, tokenIn, tokenOut, volume)
+}
 
-	err := models.DB.Create(priceTick)
+// updateLiquidity applies a Mint or Burn to the ticks bounding the position
+// and, when the position is in range, to the active liquidity, the way
+// Pool._modifyPosition does. The tick list is shared with copies of the edge
+// kept for rollback, so it is replaced rather than modified.
+func (e *EVMEdgeV3) updateLiquidity(pendingLog types.Log) {
+	if len(pendingLog.Topics) < 4 {
+		return
+	}
+
+	data := utils.Chunks(common.Bytes2Hex(pendingLog.Data), 64)
+	var amount *big.Int
+	if pendingLog.Topics[0] == MintV3Topic && len(data) >= 2 {
+		amount = utils.StringToBigInt(data[1])
+	} else if pendingLog.Topics[0] == BurnV3Topic && len(data) >= 1 {
+		amount = new(big.Int).Neg(utils.StringToBigInt(data[0]))
+	}
+	if amount == nil || amount.Sign() == 0 {
+		return
+	}
+
+	tickLower := int(utils.StringToBigInt(common.Bytes2Hex(pendingLog.Topics[2].Bytes())).Int64())
+	tickUpper := int(utils.StringToBigInt(common.Bytes2Hex(pendingLog.Topics[3].Bytes())).Int64())
+
+	ticks := updateTicks(e.Ticks, tickLower, amount, false)
+	ticks = updateTicks(ticks, tickUpper, amount, true)
+	provider, err := entities.NewTickListDataProvider(ticks, e.tickSpacing())
 	if err != nil {
-		log.Printf("[DELPHI] Err creating price tick V3: %v", err)
+		log.Printf("Failed to apply liquidity change between ticks %d and %d: %v", tickLower, tickUpper, err)
+		return
 	}
 
+	e.Ticks = ticks
+	e.TickDataProvider = provider
+	if tickLower <= e.TickCurrent && e.TickCurrent < tickUpper {
+		e.Liquidity = new(big.Int).Add(e.Liquidity, amount)
+	}
+
+	amountOut := e.ComputeExactAmountOut(config.AmountIn)
+	if amountOut == nil {
+		amountOut = constants.Zero
+	}
+	e.exchangeRate = new(big.Float).Quo(new(big.Float).SetInt(amountOut), new(big.Float).SetInt(config.AmountIn))
+}
+
+// updateTicks returns a copy of ticks, sorted by index, with delta liquidity
+// added at index: to its net liquidity for the lower tick of a position, or
+// subtracted from it for the upper tick. Ticks left without gross liquidity
+// are uninitialized and removed.
+func updateTicks(ticks []entities.Tick, index int, delta *big.Int, upper bool) []entities.Tick {
+	i := sort.Search(len(ticks), func(i int) bool { return ticks[i].Index >= index })
+
+	tick := entities.Tick{Index: index, LiquidityGross: new(big.Int), LiquidityNet: new(big.Int)}
+	found := i < len(ticks) && ticks[i].Index == index
+	if found {
+		tick = ticks[i]
+	}
+
+	netDelta := delta
+	if upper {
+		netDelta = new(big.Int).Neg(delta)
+	}
+	tick = entities.Tick{
+		Index:          index,
+		LiquidityGross: new(big.Int).Add(tick.LiquidityGross, delta),
+		LiquidityNet:   new(big.Int).Add(tick.LiquidityNet, netDelta),
+	}
+
+	updated := make([]entities.Tick, 0, len(ticks)+1)
+	updated = append(updated, ticks[:i]...)
+	if tick.LiquidityGross.Sign() > 0 {
+		updated = append(updated, tick)
+	}
+	if found {
+		i++
+	}
+	return append(updated, ticks[i:]...)
 }
 
 func (e *EVMEdgeV3) ComputeExactAmountOut(inputAmount *big.Int) *big.Int {
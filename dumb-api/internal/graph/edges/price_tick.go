@@ -0,0 +1,81 @@
+package edges
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"dumb-api/internal/candles"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/tokens"
+	"dumb-api/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gobuffalo/pop/v6"
+)
+
+// sample returns the price sample of edge after vLog was applied to it.
+// volume is the amount of tokenIn the event moved, nil when unknown.
+func sample(edge graph.Edge, vLog types.Log, chain string, tokenIn, tokenOut common.Address, volume *big.Int) *graph.PriceSample {
+	return &graph.PriceSample{
+		Edge:     edge.Copy(),
+		Log:      vLog,
+		Chain:    chain,
+		TokenIn:  tokenIn,
+		TokenOut: tokenOut,
+		Volume:   volume,
+	}
+}
+
+// PriceTick simulates selling one whole TokenIn through the edge of s and
+// returns the price_ticks row of its log, dated blockTime. Amounts and price
+// are normalized by the decimals of both tokens, so ok is false until both
+// are in the tokens table.
+func PriceTick(s *graph.PriceSample, blockTime time.Time) (tick *models.PriceTick, ok bool) {
+	decimalsIn, okIn := tokens.Decimals(s.Chain, s.TokenIn)
+	decimalsOut, okOut := tokens.Decimals(s.Chain, s.TokenOut)
+	if !okIn || !okOut {
+		return nil, false
+	}
+
+	amountIn := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimalsIn)), nil)
+	amountOut := s.Edge.ComputeExactAmountOut(amountIn)
+	if amountOut == nil || amountOut.Sign() <= 0 {
+		log.Printf("[DELPHI] No amount out for price tick, Token0: %s, Token1: %s", s.TokenIn, s.TokenOut)
+		return nil, false
+	}
+
+	normalizedIn := tokens.Normalize(amountIn, decimalsIn)
+	normalizedOut := tokens.Normalize(amountOut, decimalsOut)
+
+	now := time.Now()
+	tick = &models.PriceTick{
+		Price:       normalizedOut / normalizedIn,
+		TokenIn:     s.TokenIn.String(),
+		AmountIn:    normalizedIn,
+		TokenOut:    s.TokenOut.String(),
+		AmountOut:   normalizedOut,
+		Chain:       s.Chain,
+		Pool:        s.Log.Address.String(),
+		BlockNumber: int64(s.Log.BlockNumber),
+		TxHash:      s.Log.TxHash.Hex(),
+		CreatedAt:   blockTime,
+		UpdatedAt:   now,
+	}
+
+	if s.Volume != nil {
+		tick.Volume = tokens.Normalize(new(big.Int).Abs(s.Volume), decimalsIn)
+	}
+
+	return tick, true
+}
+
+// RecordPriceTick stores tick in price_ticks and adds it to the candles.
+func RecordPriceTick(db *pop.Connection, tick *models.PriceTick) error {
+	if err := db.Create(tick); err != nil {
+		return fmt.Errorf("failed to create price tick: %w", err)
+	}
+	return candles.Record(db, tick)
+}
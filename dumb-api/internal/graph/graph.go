@@ -28,6 +28,24 @@ func GetGlobalGraph() *Graph {
 	return GlobalGraph
 }
 
+// FinalizedGraph holds the state of every pool as of the last block of its
+// chain with enough confirmations. GlobalGraph is the latest view.
+var FinalizedGraph *Graph
+
+// InitFinalizedGraph initializes the finalized graph as a copy of the global
+// graph. The caller must hold at least a read lock on the global graph.
+func InitFinalizedGraph() *Graph {
+	if FinalizedGraph == nil {
+		FinalizedGraph = GlobalGraph.Clone()
+	}
+	return FinalizedGraph
+}
+
+// GetFinalizedGraph returns the finalized graph instance
+func GetFinalizedGraph() *Graph {
+	return FinalizedGraph
+}
+
 type Graph struct {
 	Mu       sync.RWMutex
 	Edges    map[string]map[string]map[string]map[string]Edge
@@ -40,6 +58,11 @@ type Pool struct {
 	Token1  string
 	Pair    string
 	Factory string
+	Chain   string
+	Dex     string
+	// DexID identifies the evm_config.json entry of the pool's DEX, since a
+	// chain can configure several DEXes of the same type.
+	DexID string
 }
 
 type Path struct {
@@ -59,6 +82,29 @@ func NewGraph() *Graph {
 	}
 }
 
+// Clone returns a copy of g whose edges can be updated independently. Pools
+// are shared since they never change once created.
+func (g *Graph) Clone() *Graph {
+	clone := NewGraph()
+	clone.PoolFees = make(map[string]*big.Int, len(g.PoolFees))
+	for pair, pool := range g.Pools {
+		clone.Pools[pair] = pool
+	}
+	for pair, fee := range g.PoolFees {
+		clone.PoolFees[pair] = fee
+	}
+	for from, tos := range g.Edges {
+		for to, pools := range tos {
+			for pool, chains := range pools {
+				for chain, edge := range chains {
+					clone.NewEdge(from, to, pool, chain, edge.Copy())
+				}
+			}
+		}
+	}
+	return clone
+}
+
 func (g *Graph) NewEdge(from, to, pool, chain string, edge Edge) {
 	if g.Edges[from] == nil {
 		g.Edges[from] = make(map[string]map[string]map[string]Edge)
@@ -72,13 +118,44 @@ func (g *Graph) NewEdge(from, to, pool, chain string, edge Edge) {
 	g.Edges[from][to][pool][chain] = edge
 }
 
-func (g *Graph) NewPool(pool, token0, token1, factory string) {
+func (g *Graph) NewPool(pool, token0, token1, factory, chain string) {
 	if _, exists := g.Pools[pool]; !exists {
 		g.Pools[pool] = &Pool{
 			Token0:  token0,
 			Token1:  token1,
 			Pair:    pool,
 			Factory: factory,
+			Chain:   chain,
+		}
+	}
+}
+
+// AddPool registers pool unless a pool with the same address already exists.
+func (g *Graph) AddPool(pool *Pool) {
+	if _, exists := g.Pools[pool.Pair]; !exists {
+		g.Pools[pool.Pair] = pool
+	}
+}
+
+// Merge adds the pools and edges of other that are not in g yet.
+func (g *Graph) Merge(other *Graph) {
+	for _, pool := range other.Pools {
+		g.AddPool(pool)
+	}
+	g.AddEdges(other.Edges)
+}
+
+// AddEdges merges edges into the graph, keeping any edge that already exists.
+func (g *Graph) AddEdges(edges map[string]map[string]map[string]map[string]Edge) {
+	for from, tos := range edges {
+		for to, pools := range tos {
+			for pool, chains := range pools {
+				for chain, edge := range chains {
+					if g.GetEdge(from, to, pool, chain) == nil {
+						g.NewEdge(from, to, pool, chain, edge)
+					}
+				}
+			}
 		}
 	}
 }
@@ -133,40 +210,44 @@ func (g *Graph) DeleteEdge(token0, token1, pool string) {
 }
 
 func (g *Graph) DeletePool(pool string) {
-	pair := g.Pools[pool]
+	pair, exists := g.Pools[pool]
+	if !exists {
+		return
+	}
 	delete(g.Pools, pool)
 	delete(g.Edges[pair.Token0][pair.Token1], pool)
 	delete(g.Edges[pair.Token1][pair.Token0], pool)
 }
 
-func (g *Graph) GetBestPaths(start, target string, amountIn *big.Int, updateThreshold *big.Float) []Path {
+// GetBestPaths finds the route with the highest output from start, held on
+// startChain, to target. Pool edges are only taken on the chain the amount is
+// held on, so reaching a pool on another chain needs a bridge edge first.
+func (g *Graph) GetBestPaths(start, target, startChain string, amountIn *big.Int, updateThreshold *big.Float) []Path {
 	g.Mu.RLock()
 	defer g.Mu.RUnlock()
 
-	paths := make(map[string]Path)
+	origin := holding{token: start, chain: startChain}
+	hops := make(map[holding]hop)
 	visitedPools := make(map[string]bool)
 
-	queue := utils.NewQueue[string]()
-	queue.Enqueue(start)
+	queue := utils.NewQueue[holding]()
+	queue.Enqueue(origin)
 
-	paths[start] = Path{
+	hops[origin] = hop{Path: Path{
 		TokenIn:   start,
 		TokenOut:  "",
 		AmountOut: amountIn,
-		Chain:     "avalanche",
-	}
+		Chain:     startChain,
+	}}
 
 	for !queue.IsEmpty() {
-		currentAsset := queue.Dequeue()
+		current := queue.Dequeue()
 
-		currentBestAmount := paths[currentAsset].AmountOut
+		currentBestAmount := hops[current].AmountOut
 
-		for targetAsset, pools := range g.Edges[currentAsset] {
-			var (
-				bestPoolAmount *big.Int
-				bestPool       string
-				bestChain      string
-			)
+		for targetAsset, pools := range g.Edges[current.token] {
+			// The best pool to reach targetAsset, per chain it is received on.
+			best := make(map[string]Path)
 
 			for pool, edges := range pools {
 				if _, ok := visitedPools[pool]; ok {
@@ -174,58 +255,100 @@ func (g *Graph) GetBestPaths(start, target string, amountIn *big.Int, updateThre
 				}
 
 				for chain, edge := range edges {
+					received, ok := hopChain(edge, chain, current.chain)
+					if !ok {
+						continue
+					}
+
 					highSa := edge.ComputeExactAmountOut(currentBestAmount)
 
 					if highSa == nil || highSa.Sign() <= 0 {
 						continue
 					}
 
-					if bestPoolAmount == nil || highSa.Cmp(bestPoolAmount) > 0 {
-						bestPoolAmount = highSa
-						bestPool = pool
-						bestChain = chain
+					if bestPath, exists := best[received]; !exists || highSa.Cmp(bestPath.AmountOut) > 0 {
+						best[received] = Path{Pool: pool, AmountOut: highSa, Chain: received}
 					}
 				}
 			}
 
-			if bestPoolAmount != nil {
-				visitedPools[bestPool] = true
+			for chain, bestPath := range best {
+				visitedPools[bestPath.Pool] = true
+
+				next := holding{token: targetAsset, chain: chain}
+				queue.Enqueue(next)
+
+				if existing, exists := hops[next]; !exists || bestPath.AmountOut.Cmp(existing.AmountOut) > 0 {
+					hops[next] = hop{
+						Path: Path{
+							TokenIn:     current.token,
+							Pool:        bestPath.Pool,
+							AmountOut:   bestPath.AmountOut,
+							Chain:       chain,
+							TokenOut:    targetAsset,
+							TokenHome:   g.GetTokenHome(targetAsset, chain),
+							TokenRemote: g.GetTokenRemote(targetAsset, chain),
+						},
+						prev: current,
+					}
+				}
 			}
+		}
+	}
 
-			if bestPoolAmount == nil {
-				continue
-			}
+	return buildPath(hops, origin, target)
+}
 
-			queue.Enqueue(targetAsset)
+// holding is a token held on a chain, the state a route moves between.
+type holding struct {
+	token string
+	chain string
+}
 
-			if existingPath, exists := paths[targetAsset]; !exists || bestPoolAmount.Cmp(existingPath.AmountOut) > 0 {
-				tokenHome := g.GetTokenHome(targetAsset, bestChain)
-				tokenRemote := g.GetTokenRemote(targetAsset, bestChain)
+// hop is the best known way to reach a holding, from the holding before it.
+type hop struct {
+	Path
+	prev holding
+}
 
-				paths[targetAsset] = Path{
-					TokenIn:     currentAsset,
-					Pool:        bestPool,
-					AmountOut:   bestPoolAmount,
-					Chain:       bestChain,
-					TokenOut:    targetAsset,
-					TokenHome:   tokenHome,
-					TokenRemote: tokenRemote,
-				}
-			}
-		}
+// hopChain reports whether edge, stored under chain, can be taken with an
+// amount held on held, and the chain the output is received on.
+func hopChain(edge Edge, chain, held string) (string, bool) {
+	if bridge, ok := edge.(Bridge); ok {
+		from, to := bridge.Chains()
+		return to, from == held
 	}
-
-	return buildPath(paths, start, target)
+	return chain, chain == held
 }
 
-func buildPath(paths map[string]Path, start, target string) []Path {
+// buildPath returns the hops from origin to the holding of target, on any
+// chain, that receives the most.
+func buildPath(hops map[holding]hop, origin holding, target string) []Path {
+	var (
+		end   holding
+		found bool
+	)
+	for h, step := range hops {
+		if h.token != target || h == origin {
+			continue
+		}
+		if !found || step.AmountOut.Cmp(hops[end].AmountOut) > 0 {
+			end, found = h, true
+		}
+	}
+	if !found {
+		return nil
+	}
+
 	var path []Path
-	for target != start {
-		path = append([]Path{paths[target]}, path...)
-		target = paths[target].TokenIn
-		if target == "" {
-			break
+	seen := make(map[holding]bool)
+	for h := end; h != origin; h = hops[h].prev {
+		// A later improvement can point a hop back at one of its successors.
+		if seen[h] {
+			return nil
 		}
+		seen[h] = true
+		path = append([]Path{hops[h].Path}, path...)
 	}
 	return path
 }
@@ -0,0 +1,216 @@
+// Package history persists the state of pools block by block, so the graph
+// of a chain can be rebuilt as it was after any past block and quoted
+// against.
+//
+// The listener stores the state of every pool a block changed, and every
+// CheckpointInterval the state of every pool of the chain. The state of a
+// chain after block N is then the newest row of each pool at or before N,
+// looking no further back than the last checkpoint at or before N.
+package history
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"dumb-api/config"
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/graph/edges"
+	"dumb-api/models"
+
+	"github.com/gobuffalo/pop/v6"
+)
+
+const (
+	// Table is the retention policy key of the pool state history.
+	Table = "pool_state_history"
+
+	// CheckpointInterval is how often the state of every pool of a chain is
+	// stored, which bounds how far back rebuilding a past block looks.
+	CheckpointInterval = 6 * time.Hour
+)
+
+// ErrNoHistory is returned when no checkpoint precedes the requested block or
+// time, because it predates the recorded history.
+var ErrNoHistory = errors.New("no pool state recorded at or before this point")
+
+// Record stores rows, replacing the state already recorded for the same pool
+// and block. A block stays a checkpoint once recorded as one.
+func Record(db *pop.Connection, rows []*models.PoolHistory) error {
+	for _, row := range rows {
+		err := db.RawQuery(
+			`INSERT INTO pool_state_history (chain, pool, dex, token0, token1, factory, block_number, block_time, state, checkpoint, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (chain, pool, block_number) DO UPDATE SET
+				state = EXCLUDED.state,
+				block_time = EXCLUDED.block_time,
+				checkpoint = pool_state_history.checkpoint OR EXCLUDED.checkpoint,
+				created_at = EXCLUDED.created_at`,
+			row.Chain, row.Pool, row.Dex, row.Token0, row.Token1, row.Factory,
+			row.BlockNumber, row.BlockTime, row.State, row.Checkpoint, time.Now(),
+		).Exec()
+		if err != nil {
+			return fmt.Errorf("failed to record state of pool %s at block %d: %w", row.Pool, row.BlockNumber, err)
+		}
+	}
+	return nil
+}
+
+// Rollback deletes the states recorded for the blocks of chain after block,
+// which a reorg orphaned.
+func Rollback(db *pop.Connection, chain string, block int64) error {
+	err := db.RawQuery("DELETE FROM pool_state_history WHERE chain = ? AND block_number > ?", chain, block).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to roll back pool state history of %s to block %d: %w", chain, block, err)
+	}
+	return nil
+}
+
+// Prune deletes the states no longer needed to rebuild the blocks after
+// before, which are all those older than the last checkpoint of each chain
+// taken by then.
+func Prune(db *pop.Connection, before time.Time) error {
+	err := db.RawQuery(
+		`WITH kept AS (
+			SELECT chain, MAX(block_number) AS block_number FROM pool_state_history
+			WHERE checkpoint AND block_time <= ?
+			GROUP BY chain
+		)
+		DELETE FROM pool_state_history h USING kept
+		WHERE h.chain = kept.chain AND h.block_number < kept.block_number`,
+		before,
+	).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to prune pool state history: %w", err)
+	}
+	return nil
+}
+
+// BlockAt returns the last block of chain recorded at or before t. No pool
+// changed between that block and t, so its state is the state at t.
+func BlockAt(db *pop.Connection, chain string, t time.Time) (int64, error) {
+	var row struct {
+		BlockNumber sql.NullInt64 `db:"block_number"`
+	}
+	err := db.RawQuery(
+		"SELECT MAX(block_number) AS block_number FROM pool_state_history WHERE chain = ? AND block_time <= ?",
+		chain, t,
+	).First(&row)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find the %s block at %s: %w", chain, t, err)
+	}
+	if !row.BlockNumber.Valid {
+		return 0, ErrNoHistory
+	}
+	return row.BlockNumber.Int64, nil
+}
+
+// LoadAll rebuilds the pools of chain as they were once block was applied,
+// along with the pools of every other configured chain as they were at the
+// time of that block and the bridge edges between chains, so that quotes can
+// take the cross-chain routes the live graph offers. Other chains without
+// history at that time are left out.
+func LoadAll(db *pop.Connection, chain string, block int64) (*graph.Graph, error) {
+	g, err := Load(db, chain, block)
+	if err != nil {
+		return nil, err
+	}
+
+	var row struct {
+		BlockTime sql.NullTime `db:"block_time"`
+	}
+	err = db.RawQuery(
+		"SELECT MAX(block_time) AS block_time FROM pool_state_history WHERE chain = ? AND block_number <= ?",
+		chain, block,
+	).First(&row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the time of %s block %d: %w", chain, block, err)
+	}
+
+	for chainName := range config.GetEVMConfig() {
+		other := strings.ToLower(chainName)
+		if other == chain || !row.BlockTime.Valid {
+			continue
+		}
+		otherBlock, err := BlockAt(db, other, row.BlockTime.Time)
+		if errors.Is(err, ErrNoHistory) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		otherGraph, err := Load(db, other, otherBlock)
+		if errors.Is(err, ErrNoHistory) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		g.Merge(otherGraph)
+	}
+
+	edges.AddBridges(g)
+	return g, nil
+}
+
+// Load rebuilds the pools of chain as they were once block was applied, in a
+// graph of their own. Pools whose DEX is no longer configured are left out.
+func Load(db *pop.Connection, chain string, block int64) (*graph.Graph, error) {
+	var checkpoint struct {
+		BlockNumber sql.NullInt64 `db:"block_number"`
+	}
+	err := db.RawQuery(
+		"SELECT MAX(block_number) AS block_number FROM pool_state_history WHERE chain = ? AND checkpoint AND block_number <= ?",
+		chain, block,
+	).First(&checkpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the checkpoint of %s block %d: %w", chain, block, err)
+	}
+	if !checkpoint.BlockNumber.Valid {
+		return nil, ErrNoHistory
+	}
+
+	var rows models.PoolHistories
+	err = db.RawQuery(
+		`SELECT DISTINCT ON (pool) * FROM pool_state_history
+		WHERE chain = ? AND block_number >= ? AND block_number <= ?
+		ORDER BY pool, block_number DESC`,
+		chain, checkpoint.BlockNumber.Int64, block,
+	).All(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the pools of %s at block %d: %w", chain, block, err)
+	}
+
+	g := graph.NewGraph()
+	for _, row := range rows {
+		pool := &graph.Pool{
+			Token0:  row.Token0,
+			Token1:  row.Token1,
+			Pair:    row.Pool,
+			Factory: row.Factory,
+			Chain:   row.Chain,
+			Dex:     row.Dex,
+			DexID:   dexes.IDFor(row.Chain, row.Dex, row.Factory),
+		}
+		adapter := dexes.AdapterFor(pool)
+		if adapter == nil {
+			continue
+		}
+		edge01, edge10, err := adapter.ImportState(pool, row.State)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import pool %s at block %d: %w", row.Pool, row.BlockNumber, err)
+		}
+
+		g.AddPool(pool)
+		if edge01 != nil {
+			g.NewEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain, edge01)
+		}
+		if edge10 != nil {
+			g.NewEdge(pool.Token1, pool.Token0, pool.Pair, pool.Chain, edge10)
+		}
+	}
+	return g, nil
+}
@@ -0,0 +1,170 @@
+// Package oracle computes time-weighted average prices of pools, from their
+// on-chain oracle when they keep one and from the recorded price ticks
+// otherwise.
+package oracle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/tokens"
+	"dumb-api/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobuffalo/pop/v6"
+)
+
+// Sources of a TWAP.
+const (
+	SourceObserve    = "observe"
+	SourcePriceTicks = "price_ticks"
+)
+
+// ErrNoData is returned when a pool has neither a usable oracle nor price
+// ticks over the window.
+var ErrNoData = errors.New("no price data over the window")
+
+// TWAP is the geometric mean price of Token0 in Token1 over a window, and of
+// Token1 in Token0 as InversePrice.
+type TWAP struct {
+	Chain        string    `json:"chain"`
+	Pool         string    `json:"pool"`
+	Token0       string    `json:"token0"`
+	Token1       string    `json:"token1"`
+	Window       int64     `json:"window"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+	Source       string    `json:"source"`
+	Price        float64   `json:"price"`
+	InversePrice float64   `json:"inversePrice"`
+	// MeanTick and HarmonicMeanLiquidity are only known from the oracle.
+	MeanTick              *int   `json:"meanTick,omitempty"`
+	HarmonicMeanLiquidity string `json:"harmonicMeanLiquidity,omitempty"`
+	// Samples is how many price ticks the fallback averaged.
+	Samples int `json:"samples,omitempty"`
+	// Fallback tells why the oracle was not used.
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// Compute returns the TWAP of pool over the window ending now. Pools whose
+// adapter is an Oracle are observed on-chain; when that fails, typically
+// because the observation cardinality does not cover window, or for other
+// pools, the prices recorded in price_ticks are averaged instead.
+func Compute(ctx context.Context, db *pop.Connection, pool *graph.Pool, window time.Duration) (*TWAP, error) {
+	token0, token1 := common.HexToAddress(pool.Token0), common.HexToAddress(pool.Token1)
+	decimals0, ok0 := tokens.Decimals(pool.Chain, token0)
+	decimals1, ok1 := tokens.Decimals(pool.Chain, token1)
+	if !ok0 || !ok1 {
+		return nil, fmt.Errorf("decimals of the tokens of pool %s are unknown", pool.Pair)
+	}
+
+	to := time.Now().UTC()
+	twap := &TWAP{
+		Chain:  pool.Chain,
+		Pool:   pool.Pair,
+		Token0: token0.Hex(),
+		Token1: token1.Hex(),
+		Window: int64(window / time.Second),
+		From:   to.Add(-window),
+		To:     to,
+	}
+
+	oracle, ok := dexes.AdapterFor(pool).(dexes.Oracle)
+	if ok {
+		observation, err := oracle.Observe(ctx, pool, window)
+		if err == nil {
+			tick := observation.MeanTick
+			twap.Source = SourceObserve
+			twap.MeanTick = &tick
+			twap.Price = tickPrice(tick, decimals0, decimals1)
+			twap.InversePrice = reciprocal(twap.Price)
+			twap.HarmonicMeanLiquidity = observation.HarmonicMeanLiquidity.String()
+			return twap, nil
+		}
+		twap.Fallback = err.Error()
+	} else {
+		twap.Fallback = fmt.Sprintf("%s pools have no oracle", pool.Dex)
+	}
+
+	price, samples, from, err := fromPriceTicks(db.WithContext(ctx), pool, twap.From, to)
+	if err != nil {
+		return nil, err
+	}
+	twap.Source = SourcePriceTicks
+	twap.Price = price
+	twap.InversePrice = reciprocal(price)
+	twap.Samples = samples
+	twap.From = from
+	return twap, nil
+}
+
+// fromPriceTicks averages the logarithm of the token0 price ticks of pool
+// between from and to, each weighted by how long it held. The price before
+// the first tick of the window is the last one recorded before it; without
+// one the window starts at the first tick, which is returned as its start.
+// Ticks are prices of selling one whole token, so they include the fee.
+func fromPriceTicks(db *pop.Connection, pool *graph.Pool, from, to time.Time) (float64, int, time.Time, error) {
+	pair := common.HexToAddress(pool.Pair).Hex()
+	token0, token1 := common.HexToAddress(pool.Token0).Hex(), common.HexToAddress(pool.Token1).Hex()
+
+	var ticks models.PriceTicks
+	err := db.RawQuery(
+		`(SELECT * FROM price_ticks WHERE pool = ? AND token_in = ? AND token_out = ? AND created_at < ? AND price > 0
+			ORDER BY created_at DESC LIMIT 1)
+		UNION ALL
+		(SELECT * FROM price_ticks WHERE pool = ? AND token_in = ? AND token_out = ? AND created_at >= ? AND created_at <= ? AND price > 0)
+		ORDER BY created_at`,
+		pair, token0, token1, from,
+		pair, token0, token1, from, to,
+	).All(&ticks)
+	if err != nil {
+		return 0, 0, from, fmt.Errorf("failed to get price ticks of pool %s: %w", pool.Pair, err)
+	}
+	if len(ticks) == 0 {
+		return 0, 0, from, ErrNoData
+	}
+
+	start := from
+	if ticks[0].CreatedAt.After(from) {
+		start = ticks[0].CreatedAt
+	}
+
+	var weighted, total float64
+	for i, tick := range ticks {
+		begin := tick.CreatedAt
+		if begin.Before(start) {
+			begin = start
+		}
+		end := to
+		if i+1 < len(ticks) {
+			end = ticks[i+1].CreatedAt
+		}
+		if seconds := end.Sub(begin).Seconds(); seconds > 0 {
+			weighted += math.Log(tick.Price) * seconds
+			total += seconds
+		}
+	}
+
+	if total == 0 {
+		return ticks[len(ticks)-1].Price, len(ticks), start, nil
+	}
+	return math.Exp(weighted / total), len(ticks), start, nil
+}
+
+// tickPrice returns the price of one whole token0 in token1 at tick, for
+// tokens of decimals0 and decimals1 decimals.
+func tickPrice(tick, decimals0, decimals1 int) float64 {
+	return math.Pow(1.0001, float64(tick)) * math.Pow10(decimals0-decimals1)
+}
+
+func reciprocal(price float64) float64 {
+	if price == 0 {
+		return 0
+	}
+	return 1 / price
+}
@@ -0,0 +1,31 @@
+package oracle
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTickPrice(t *testing.T) {
+	tests := []struct {
+		name                 string
+		tick                 int
+		decimals0, decimals1 int
+		want                 float64
+	}{
+		{"tick zero", 0, 18, 18, 1},
+		{"positive tick", 23027, 18, 18, 10},
+		{"negative tick", -23027, 18, 18, 0.1},
+		{"token0 with more decimals", 0, 18, 6, 1e12},
+		{"token1 with more decimals", 0, 6, 18, 1e-12},
+		{"negative tick and decimals", -276324, 18, 6, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tickPrice(tt.tick, tt.decimals0, tt.decimals1)
+			if math.Abs(got-tt.want)/tt.want > 1e-4 {
+				t.Errorf("tickPrice(%d, %d, %d) = %g, want %g", tt.tick, tt.decimals0, tt.decimals1, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,471 @@
+// Package pricing values tokens in USD. The Engine derives the price of every
+// token of the graph by routing it to the stablecoins configured on its
+// chain, scores how much the price can be trusted from the depth of the
+// token's pools, and falls back to an external source when that score is
+// low. Tokens the engine cannot price fall back to the tokens table.
+package pricing
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dumb-api/config"
+	"dumb-api/internal/contracts"
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/rpcpool"
+	"dumb-api/internal/tokens"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobuffalo/pop/v6"
+)
+
+// Sources of a price.
+const (
+	SourceAnchor   = "anchor"
+	SourceGraph    = "graph"
+	SourceFallback = "coingecko"
+	SourceTokens   = "tokens"
+)
+
+const (
+	// LiquidityFraction is the share of a token's pool depth routed to the
+	// anchors to price it, small enough to keep price impact negligible and
+	// large enough to avoid rounding on tokens with few decimals.
+	LiquidityFraction = 0.001
+
+	// HalfConfidenceDepth is the USD depth at which a graph price scores a
+	// confidence of 0.5. Confidence approaches 1 as depth grows past it.
+	HalfConfidenceDepth = 50_000.0
+
+	// MinConfidence is the confidence below which the fallback source is
+	// consulted.
+	MinConfidence = 0.5
+
+	// RefreshInterval is how often every token is repriced. Tokens of pools
+	// that change are repriced within RefreshDelay.
+	RefreshInterval = time.Minute
+	RefreshDelay    = 2 * time.Second
+
+	// fallbackTTL is how long a fallback answer, or its absence, is reused.
+	fallbackTTL = 10 * time.Minute
+)
+
+// Stablecoins are the symbols of the configured tokens taken to be worth one
+// dollar.
+var Stablecoins = []string{"USDC", "USDT", "DAI"}
+
+// Price is the USD price of a token. Confidence scores the graph route the
+// price was derived from between 0 and 1, so a fallback price carries the
+// low score that caused the lookup.
+type Price struct {
+	Chain      string    `json:"chain" db:"chain"`
+	Address    string    `json:"address" db:"address"`
+	USD        float64   `json:"usd" db:"price_usd"`
+	Confidence float64   `json:"confidence" db:"confidence"`
+	DepthUSD   float64   `json:"depthUsd" db:"depth_usd"`
+	Source     string    `json:"source" db:"source"`
+	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// Fallback looks up the USD price of a token on a chain named as in
+// evm_config.json.
+type Fallback func(chain, address string) (float64, error)
+
+type fallbackEntry struct {
+	price   float64
+	ok      bool
+	checked time.Time
+}
+
+// Engine keeps the USD price of every token of the global graph up to date.
+type Engine struct {
+	db       *pop.Connection
+	clients  rpcpool.Lookup
+	fallback Fallback
+
+	mu        sync.RWMutex
+	prices    map[string]Price
+	fallbacks map[string]fallbackEntry
+
+	dirtyMu sync.Mutex
+	dirty   map[string]map[common.Address]bool
+	wake    chan struct{}
+}
+
+var engine *Engine
+
+// InitEngine creates the process wide engine. The RPC provider pools clients
+// finds read the decimals of tokens missing from the tokens table. Prices are persisted in token_prices when db is set, and
+// fallback, when set, is consulted for low confidence prices.
+func InitEngine(db *pop.Connection, clients rpcpool.Lookup, fallback Fallback) *Engine {
+	if engine == nil {
+		engine = &Engine{
+			db:        db,
+			clients:   clients,
+			fallback:  fallback,
+			prices:    make(map[string]Price),
+			fallbacks: make(map[string]fallbackEntry),
+			dirty:     make(map[string]map[common.Address]bool),
+			wake:      make(chan struct{}, 1),
+		}
+	}
+	return engine
+}
+
+// GetEngine returns the process wide engine, or nil if it was not started.
+func GetEngine() *Engine {
+	return engine
+}
+
+// USDPrice returns the price of one whole token on chain, from the engine
+// when it priced the token and from the tokens table otherwise.
+func USDPrice(chain string, token common.Address) (float64, bool) {
+	if engine != nil {
+		if price, ok := engine.Price(chain, token); ok && price.USD > 0 {
+			return price.USD, true
+		}
+	}
+	return tokens.USDPrice(chain, token)
+}
+
+// Touch schedules the tokens of pools whose state changed for repricing. It
+// does nothing when no engine runs in the process.
+func Touch(pools ...*graph.Pool) {
+	if engine == nil || len(pools) == 0 {
+		return
+	}
+
+	engine.dirtyMu.Lock()
+	for _, pool := range pools {
+		if engine.dirty[pool.Chain] == nil {
+			engine.dirty[pool.Chain] = make(map[common.Address]bool)
+		}
+		engine.dirty[pool.Chain][common.HexToAddress(pool.Token0)] = true
+		engine.dirty[pool.Chain][common.HexToAddress(pool.Token1)] = true
+	}
+	engine.dirtyMu.Unlock()
+
+	select {
+	case engine.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Price returns the last price computed for token on chain.
+func (e *Engine) Price(chain string, token common.Address) (Price, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	price, ok := e.prices[key(chain, token)]
+	return price, ok
+}
+
+// Prices returns every price computed on chain, or on every chain when chain
+// is empty, ordered by chain and address.
+func (e *Engine) Prices(chain string) []Price {
+	e.mu.RLock()
+	result := make([]Price, 0, len(e.prices))
+	for _, price := range e.prices {
+		if chain == "" || price.Chain == chain {
+			result = append(result, price)
+		}
+	}
+	e.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Chain != result[j].Chain {
+			return result[i].Chain < result[j].Chain
+		}
+		return result[i].Address < result[j].Address
+	})
+	return result
+}
+
+// Start reprices every token right away and every RefreshInterval, and the
+// tokens of touched pools RefreshDelay after they change, until ctx is
+// cancelled.
+func (e *Engine) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(RefreshInterval)
+		defer ticker.Stop()
+
+		e.Refresh(ctx, nil)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				e.takeDirty()
+				e.Refresh(ctx, nil)
+			case <-e.wake:
+				// Let the rest of the block, or burst of blocks, land
+				// before repricing.
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(RefreshDelay):
+				}
+				if dirty := e.takeDirty(); len(dirty) > 0 {
+					e.Refresh(ctx, dirty)
+				}
+			}
+		}
+	}()
+}
+
+func (e *Engine) takeDirty() map[string]map[common.Address]bool {
+	e.dirtyMu.Lock()
+	defer e.dirtyMu.Unlock()
+	dirty := e.dirty
+	e.dirty = make(map[string]map[common.Address]bool)
+	return dirty
+}
+
+// Refresh reprices the selected tokens of each chain, or every token of the
+// graph and of evm_config.json when selected is nil.
+func (e *Engine) Refresh(ctx context.Context, selected map[string]map[common.Address]bool) {
+	g := graph.GetGlobalGraph()
+	if g == nil {
+		return
+	}
+
+	if selected == nil {
+		selected = allTokens(g)
+	}
+
+	var updated []Price
+	for chain, chainTokens := range selected {
+		anchors := Anchors(chain)
+		for token := range chainTokens {
+			if ctx.Err() != nil {
+				return
+			}
+			price, ok := e.price(ctx, g, chain, token, anchors)
+			if !ok {
+				continue
+			}
+			e.mu.Lock()
+			e.prices[key(chain, token)] = price
+			e.mu.Unlock()
+			updated = append(updated, price)
+		}
+	}
+
+	if e.db != nil {
+		db := e.db.WithContext(ctx)
+		for _, price := range updated {
+			if err := store(db, price); err != nil {
+				log.Printf("Failed to store price of %s on %s: %v", price.Address, price.Chain, err)
+			}
+		}
+	}
+}
+
+// price computes the price of token on chain.
+func (e *Engine) price(ctx context.Context, g *graph.Graph, chain string, token common.Address, anchors []common.Address) (Price, bool) {
+	price := Price{Chain: chain, Address: token.Hex(), UpdatedAt: time.Now()}
+
+	for _, anchor := range anchors {
+		if anchor == token {
+			price.USD, price.Confidence, price.Source = 1, 1, SourceAnchor
+			return price, true
+		}
+	}
+
+	if decimals, ok := e.decimals(ctx, chain, token); ok {
+		depth := poolDepth(g, chain, token)
+		if usd, ok := e.quote(ctx, g, chain, token, decimals, depth, anchors); ok {
+			price.USD, price.Source = usd, SourceGraph
+			price.DepthUSD = tokens.Normalize(depth, decimals) * usd
+			price.Confidence = price.DepthUSD / (price.DepthUSD + HalfConfidenceDepth)
+		}
+	}
+
+	if price.Confidence < MinConfidence {
+		if usd, ok := e.lookupFallback(chain, token); ok {
+			price.USD, price.Source = usd, SourceFallback
+		}
+	}
+
+	if price.USD == 0 {
+		usd, ok := tokens.USDPrice(chain, token)
+		if !ok {
+			return price, false
+		}
+		price.USD, price.Source = usd, SourceTokens
+	}
+	return price, true
+}
+
+// quote routes LiquidityFraction of depth from token to every anchor and
+// returns the best USD amount received per whole token.
+func (e *Engine) quote(ctx context.Context, g *graph.Graph, chain string, token common.Address, decimals int, depth *big.Int, anchors []common.Address) (float64, bool) {
+	amountIn, _ := new(big.Float).Mul(new(big.Float).SetInt(depth), big.NewFloat(LiquidityFraction)).Int(nil)
+	if amountIn.Sign() <= 0 {
+		return 0, false
+	}
+	tokensIn := tokens.Normalize(amountIn, decimals)
+
+	var best float64
+	for _, anchor := range anchors {
+		anchorDecimals, ok := e.decimals(ctx, chain, anchor)
+		if !ok {
+			continue
+		}
+
+		paths := g.GetBestPaths(token.Hex(), anchor.Hex(), chain, amountIn, new(big.Float).SetFloat64(0.01))
+		if len(paths) == 0 {
+			continue
+		}
+		last := paths[len(paths)-1]
+		if last.TokenOut != anchor.Hex() || last.AmountOut == nil {
+			continue
+		}
+		best = max(best, tokens.Normalize(last.AmountOut, anchorDecimals)/tokensIn)
+	}
+	return best, best > 0
+}
+
+// decimals returns the decimals of token from the tokens table, or from its
+// contract when the table does not know it.
+func (e *Engine) decimals(ctx context.Context, chain string, token common.Address) (int, bool) {
+	if decimals, ok := tokens.Decimals(chain, token); ok {
+		return decimals, true
+	}
+
+	client, ok := e.clients(strings.ToUpper(chain))
+	if !ok {
+		return 0, false
+	}
+	decimals, err := contracts.Decimals(ctx, client, token)
+	if err != nil {
+		log.Printf("Failed to get decimals of %s on %s: %v", token, chain, err)
+		return 0, false
+	}
+	tokens.SetDecimals(chain, token, decimals)
+	return decimals, true
+}
+
+// lookupFallback asks the fallback source for the price of token, reusing
+// answers for fallbackTTL to stay within its rate limits.
+func (e *Engine) lookupFallback(chain string, token common.Address) (float64, bool) {
+	if e.fallback == nil {
+		return 0, false
+	}
+
+	k := key(chain, token)
+	e.mu.RLock()
+	cached, found := e.fallbacks[k]
+	e.mu.RUnlock()
+	if found && time.Since(cached.checked) < fallbackTTL {
+		return cached.price, cached.ok
+	}
+
+	price, err := e.fallback(chain, token.Hex())
+	result := fallbackEntry{price: price, ok: err == nil && price > 0, checked: time.Now()}
+
+	e.mu.Lock()
+	e.fallbacks[k] = result
+	e.mu.Unlock()
+	return result.price, result.ok
+}
+
+// Anchors returns the addresses of the stablecoins configured on chain.
+func Anchors(chain string) []common.Address {
+	chainConfig, ok := config.GetChainConfig(chain)
+	if !ok {
+		return nil
+	}
+
+	var anchors []common.Address
+	for _, token := range chainConfig.Tokens {
+		for _, symbol := range Stablecoins {
+			if strings.EqualFold(token.Symbol, symbol) {
+				anchors = append(anchors, common.HexToAddress(token.Address))
+			}
+		}
+	}
+	return anchors
+}
+
+// poolDepth sums the amounts of token backing the price of its pools on
+// chain.
+func poolDepth(g *graph.Graph, chain string, token common.Address) *big.Int {
+	g.Mu.RLock()
+	defer g.Mu.RUnlock()
+
+	depth := new(big.Int)
+	for _, pool := range g.Pools {
+		if pool.Chain != chain {
+			continue
+		}
+		is0, is1 := common.HexToAddress(pool.Token0) == token, common.HexToAddress(pool.Token1) == token
+		if !is0 && !is1 {
+			continue
+		}
+		reader, ok := dexes.AdapterFor(pool).(dexes.DepthReader)
+		if !ok {
+			continue
+		}
+		reserve0, reserve1, ok := reader.Depth(g, pool)
+		if !ok {
+			continue
+		}
+		if is0 {
+			depth.Add(depth, reserve0)
+		} else {
+			depth.Add(depth, reserve1)
+		}
+	}
+	return depth
+}
+
+// allTokens returns the tokens of every pool of g and of evm_config.json,
+// per chain.
+func allTokens(g *graph.Graph) map[string]map[common.Address]bool {
+	all := make(map[string]map[common.Address]bool)
+	add := func(chain string, token common.Address) {
+		if all[chain] == nil {
+			all[chain] = make(map[common.Address]bool)
+		}
+		all[chain][token] = true
+	}
+
+	g.Mu.RLock()
+	for _, pool := range g.Pools {
+		add(pool.Chain, common.HexToAddress(pool.Token0))
+		add(pool.Chain, common.HexToAddress(pool.Token1))
+	}
+	g.Mu.RUnlock()
+
+	for chainName, chainConfig := range config.GetEVMConfig() {
+		for _, token := range chainConfig.Tokens {
+			add(strings.ToLower(chainName), common.HexToAddress(token.Address))
+		}
+	}
+	return all
+}
+
+// store upserts price into token_prices.
+func store(db *pop.Connection, price Price) error {
+	return db.RawQuery(
+		`INSERT INTO token_prices (chain, address, price_usd, confidence, depth_usd, source, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chain, address) DO UPDATE SET
+			price_usd = EXCLUDED.price_usd,
+			confidence = EXCLUDED.confidence,
+			depth_usd = EXCLUDED.depth_usd,
+			source = EXCLUDED.source,
+			updated_at = EXCLUDED.updated_at`,
+		price.Chain, price.Address, price.USD, price.Confidence, price.DepthUSD, price.Source, price.UpdatedAt,
+	).Exec()
+}
+
+func key(chain string, token common.Address) string {
+	return chain + ":" + token.Hex()
+}
@@ -0,0 +1,192 @@
+// Package retention enforces how long price history is kept. Expired ticks
+// and candles are first aggregated into wider candles, then deleted: ticks by
+// dropping the daily partitions of price_ticks, candles row by row. Pool
+// state history is pruned down to what rebuilding the retained blocks needs.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"dumb-api/internal/candles"
+	"dumb-api/internal/history"
+
+	"github.com/gobuffalo/pop/v6"
+)
+
+const (
+	// Interval is how often the retention job runs.
+	Interval = time.Hour
+
+	// PartitionsAhead is how many days of price_ticks partitions are kept
+	// ready past the current one.
+	PartitionsAhead = 3
+
+	// TicksTable is the retention policy key of price_ticks.
+	TicksTable = "price_ticks"
+
+	partitionPrefix = "price_ticks_"
+	partitionLayout = "20060102"
+	day             = 24 * time.Hour
+)
+
+// Start runs the retention job right away and every Interval until ctx is
+// cancelled. Policies map tables to how long their rows are kept, as in
+// config.Retention.
+func Start(ctx context.Context, db *pop.Connection, policies map[string]time.Duration) {
+	go func() {
+		ticker := time.NewTicker(Interval)
+		defer ticker.Stop()
+
+		for {
+			if err := Run(ctx, db, policies, time.Now()); err != nil && ctx.Err() == nil {
+				log.Printf("Retention job failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run creates the upcoming partitions of price_ticks and applies policies
+// as of now. Cutoffs are rounded down to midnight UTC so whole partitions
+// and whole candles of every interval expire together.
+func Run(ctx context.Context, db *pop.Connection, policies map[string]time.Duration, now time.Time) error {
+	db = db.WithContext(ctx)
+	today := now.UTC().Truncate(day)
+
+	partitions, err := partitions(db)
+	if err != nil {
+		return err
+	}
+	for i := 0; i <= PartitionsAhead; i++ {
+		start := today.Add(time.Duration(i) * day)
+		if _, ok := partitions[start]; ok {
+			continue
+		}
+		if err := createPartition(db, start); err != nil {
+			return err
+		}
+	}
+
+	if keep := policies[TicksTable]; keep > 0 {
+		cutoff := now.Add(-keep).UTC().Truncate(day)
+		if err := expireTicks(db, partitions, cutoff); err != nil {
+			return err
+		}
+	}
+
+	for _, interval := range candles.Intervals {
+		keep := policies[interval.Table]
+		if keep <= 0 {
+			continue
+		}
+		cutoff := now.Add(-keep).UTC().Truncate(day)
+		if err := candles.Downsample(db, interval, cutoff); err != nil {
+			return err
+		}
+		if err := db.RawQuery(fmt.Sprintf("DELETE FROM %s WHERE bucket < ?", interval.Table), cutoff).Exec(); err != nil {
+			return fmt.Errorf("failed to delete expired %s candles: %w", interval.Name, err)
+		}
+	}
+
+	if keep := policies[history.Table]; keep > 0 {
+		return history.Prune(db, now.Add(-keep))
+	}
+	return nil
+}
+
+// expireTicks backfills the candles of the ticks recorded before cutoff,
+// then drops the partitions that end by cutoff and deletes the remaining
+// expired ticks from the default partition.
+func expireTicks(db *pop.Connection, partitions map[time.Time]string, cutoff time.Time) error {
+	if err := candles.Backfill(db, cutoff); err != nil {
+		return err
+	}
+
+	for start, name := range partitions {
+		if start.Add(day).After(cutoff) {
+			continue
+		}
+		if err := db.RawQuery(fmt.Sprintf("DROP TABLE IF EXISTS %s", name)).Exec(); err != nil {
+			return fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+		log.Printf("Dropped price_ticks partition %s", name)
+	}
+
+	if err := db.RawQuery("DELETE FROM price_ticks_default WHERE created_at < ?", cutoff).Exec(); err != nil {
+		return fmt.Errorf("failed to delete expired ticks: %w", err)
+	}
+	return nil
+}
+
+// partitions returns the daily partitions of price_ticks by the day they
+// start.
+func partitions(db *pop.Connection) (map[time.Time]string, error) {
+	var rows []struct {
+		Name string `db:"name"`
+	}
+	err := db.RawQuery(
+		`SELECT c.relname AS name FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'price_ticks'`,
+	).All(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list price_ticks partitions: %w", err)
+	}
+
+	result := make(map[time.Time]string, len(rows))
+	for _, row := range rows {
+		suffix, ok := strings.CutPrefix(row.Name, partitionPrefix)
+		if !ok {
+			continue
+		}
+		start, err := time.Parse(partitionLayout, suffix)
+		if err != nil {
+			// price_ticks_default
+			continue
+		}
+		result[start] = row.Name
+	}
+	return result, nil
+}
+
+// createPartition attaches the partition of the day starting at start,
+// moving into it the ticks of that day that landed in the default partition
+// while it was missing.
+func createPartition(db *pop.Connection, start time.Time) error {
+	name := partitionPrefix + start.Format(partitionLayout)
+	end := start.Add(day)
+
+	err := db.Transaction(func(tx *pop.Connection) error {
+		statements := []struct {
+			query string
+			args  []interface{}
+		}{
+			{fmt.Sprintf("CREATE TABLE %s (LIKE price_ticks INCLUDING DEFAULTS INCLUDING CONSTRAINTS)", name), nil},
+			{fmt.Sprintf(
+				`WITH moved AS (DELETE FROM price_ticks_default WHERE created_at >= ? AND created_at < ? RETURNING *)
+				INSERT INTO %s SELECT * FROM moved`, name), []interface{}{start, end}},
+			{fmt.Sprintf("ALTER TABLE price_ticks ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')",
+				name, start.Format(time.RFC3339), end.Format(time.RFC3339)), nil},
+		}
+		for _, statement := range statements {
+			if err := tx.RawQuery(statement.query, statement.args...).Exec(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create partition %s: %w", name, err)
+	}
+	log.Printf("Created price_ticks partition %s", name)
+	return nil
+}
@@ -0,0 +1,629 @@
+package rpcpool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// headInterval is how often every provider is asked for its head, which
+	// doubles as a health probe for providers not currently serving calls.
+	headInterval = 5 * time.Second
+
+	// minHedgeDelay is the least a hedged call waits for the best provider
+	// before asking the next one as well.
+	minHedgeDelay = 50 * time.Millisecond
+
+	// lagPenalty is the latency a provider is charged per block it trails
+	// the highest head seen across the pool.
+	lagPenalty = 200 * time.Millisecond
+
+	// ewmaWeight is the weight of the newest sample in latency and error
+	// rate averages.
+	ewmaWeight = 0.2
+)
+
+// Client is the chain access shared by DEX adapters, services and the block
+// listener. It is satisfied by *Pool.
+type Client interface {
+	bind.ContractBackend
+	BlockNumber(ctx context.Context) (uint64, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// errUnseen is returned by providers that answer null or not found for a
+// block, transaction or log range they may not have seen yet. It is
+// retryable, so the call moves on to providers further ahead.
+var errUnseen = errors.New("not seen by provider yet")
+
+type criticalKey struct{}
+
+// Critical marks the reads made with ctx as critical. Pools configured with
+// a quorum answer them only once enough providers return the same result.
+func Critical(ctx context.Context) context.Context {
+	return context.WithValue(ctx, criticalKey{}, true)
+}
+
+func isCritical(ctx context.Context) bool {
+	critical, _ := ctx.Value(criticalKey{}).(bool)
+	return critical
+}
+
+type blockKey struct{}
+
+// AtBlock pins the contract calls made with ctx to block instead of the
+// latest one, so pool state can be loaded as of a past block.
+func AtBlock(ctx context.Context, block int64) context.Context {
+	return context.WithValue(ctx, blockKey{}, block)
+}
+
+// PinnedBlock returns the block the calls made with ctx are pinned to.
+func PinnedBlock(ctx context.Context) (*big.Int, bool) {
+	block, ok := ctx.Value(blockKey{}).(int64)
+	if !ok {
+		return nil, false
+	}
+	return big.NewInt(block), true
+}
+
+// callBlock returns blockNumber, or the block ctx is pinned to when it is nil.
+func callBlock(ctx context.Context, blockNumber *big.Int) *big.Int {
+	if blockNumber == nil {
+		if pinned, ok := PinnedBlock(ctx); ok {
+			return pinned
+		}
+	}
+	return blockNumber
+}
+
+// Pool spreads the calls of one chain over several RPC providers. Calls go to
+// the healthiest provider and fail over to the next on transport errors or
+// rate limiting. Latency sensitive reads are hedged, and critical reads
+// require a quorum of matching answers when one is configured.
+type Pool struct {
+	chain     string
+	providers []*provider
+	quorum    int
+
+	mu      sync.RWMutex
+	maxHead uint64
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+type provider struct {
+	url    string
+	rpc    *rpc.Client
+	client *ethclient.Client
+
+	mu        sync.Mutex
+	latency   time.Duration
+	errorRate float64
+	head      uint64
+}
+
+// Dial connects to every url and starts tracking their heads. Providers that
+// fail to connect are skipped, Dial only fails when none is reachable. A
+// quorum below 2 disables quorum reads.
+func Dial(ctx context.Context, chain string, urls []string, quorum int) (*Pool, error) {
+	pool := &Pool{
+		chain:  chain,
+		quorum: quorum,
+		stop:   make(chan struct{}),
+	}
+
+	for _, url := range urls {
+		client, err := rpc.DialContext(ctx, url)
+		if err != nil {
+			log.Printf("Failed to connect to %s provider %s: %v", chain, url, err)
+			continue
+		}
+		pool.providers = append(pool.providers, &provider{
+			url:    url,
+			rpc:    client,
+			client: ethclient.NewClient(client),
+		})
+	}
+
+	if len(pool.providers) == 0 {
+		return nil, fmt.Errorf("no reachable RPC provider for %s", chain)
+	}
+	if pool.quorum > len(pool.providers) {
+		log.Printf("Quorum of %d exceeds the %d %s providers, using all of them", pool.quorum, len(pool.providers), chain)
+		pool.quorum = len(pool.providers)
+	}
+
+	pool.pollHeads()
+	go pool.trackHeads()
+
+	return pool, nil
+}
+
+// Close stops head tracking and closes every provider. Calls after the first
+// do nothing.
+func (p *Pool) Close() {
+	p.closeOnce.Do(func() {
+		close(p.stop)
+		for _, pr := range p.providers {
+			pr.rpc.Close()
+		}
+	})
+}
+
+func (p *Pool) trackHeads() {
+	ticker := time.NewTicker(headInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.pollHeads()
+		}
+	}
+}
+
+func (p *Pool) pollHeads() {
+	var wg sync.WaitGroup
+	for _, pr := range p.providers {
+		wg.Add(1)
+		go func(pr *provider) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), headInterval)
+			defer cancel()
+
+			start := time.Now()
+			head, err := pr.client.BlockNumber(ctx)
+			pr.observe(time.Since(start), err)
+			if err != nil {
+				return
+			}
+
+			pr.mu.Lock()
+			pr.head = head
+			pr.mu.Unlock()
+
+			p.mu.Lock()
+			p.maxHead = max(p.maxHead, head)
+			p.mu.Unlock()
+		}(pr)
+	}
+	wg.Wait()
+}
+
+// observe folds the outcome of a call into the provider's health. Calls
+// cancelled by the caller, such as hedged calls that lost the race, say
+// nothing about the provider and are ignored.
+func (pr *provider) observe(latency time.Duration, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	// Lagging behind is already charged through the head.
+	failed := 0.0
+	if err != nil && retryable(err) && !errors.Is(err, errUnseen) {
+		failed = 1
+	}
+
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	if pr.latency == 0 {
+		pr.latency = latency
+	} else {
+		pr.latency = time.Duration(ewmaWeight*float64(latency) + (1-ewmaWeight)*float64(pr.latency))
+	}
+	pr.errorRate = ewmaWeight*failed + (1-ewmaWeight)*pr.errorRate
+}
+
+// score is the expected cost of a call to the provider, lower is better.
+func (pr *provider) score(maxHead uint64) float64 {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	score := float64(pr.latency) * (1 + 20*pr.errorRate)
+	if pr.head < maxHead {
+		score += float64(maxHead-pr.head) * float64(lagPenalty)
+	}
+	return score
+}
+
+// ranked returns the providers from healthiest to least healthy.
+func (p *Pool) ranked() []*provider {
+	p.mu.RLock()
+	maxHead := p.maxHead
+	p.mu.RUnlock()
+
+	providers := make([]*provider, len(p.providers))
+	copy(providers, p.providers)
+
+	scores := make(map[*provider]float64, len(providers))
+	for _, pr := range providers {
+		scores[pr] = pr.score(maxHead)
+	}
+	sort.SliceStable(providers, func(i, j int) bool {
+		return scores[providers[i]] < scores[providers[j]]
+	})
+
+	return providers
+}
+
+// retryable reports whether err means the provider, rather than the request,
+// is at fault, so the call should be sent to another provider. JSON-RPC
+// errors such as reverts are answers and are returned as is, except for
+// rate limiting and exceeded response limits.
+func retryable(err error) bool {
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.ErrorCode() == -32005
+	}
+
+	return !errors.Is(err, ethereum.NotFound)
+}
+
+// synced returns the providers whose last seen head is at or above block,
+// from healthiest to least healthy, or every provider when none is known to
+// have reached it.
+func (p *Pool) synced(block uint64) []*provider {
+	var providers []*provider
+	for _, pr := range p.ranked() {
+		pr.mu.Lock()
+		head := pr.head
+		pr.mu.Unlock()
+		if head >= block {
+			providers = append(providers, pr)
+		}
+	}
+	if len(providers) == 0 {
+		return p.ranked()
+	}
+	return providers
+}
+
+// unseen turns a not found answer into errUnseen.
+func unseen(err error) error {
+	if errors.Is(err, ethereum.NotFound) {
+		return errUnseen
+	}
+	return err
+}
+
+// found turns errUnseen back into the not found answer of the last provider
+// asked.
+func found(err error) error {
+	if errors.Is(err, errUnseen) {
+		return ethereum.NotFound
+	}
+	return err
+}
+
+// failover calls fn on each provider in health order until one succeeds or
+// returns an error that another provider would return too.
+func failover[T any](ctx context.Context, p *Pool, fn func(context.Context, *provider) (T, error)) (T, error) {
+	return failoverTo(ctx, p, p.ranked(), fn)
+}
+
+// failoverTo is failover restricted to providers, in the order given.
+func failoverTo[T any](ctx context.Context, p *Pool, providers []*provider, fn func(context.Context, *provider) (T, error)) (T, error) {
+	var result T
+	var err error
+
+	for _, pr := range providers {
+		start := time.Now()
+		result, err = fn(ctx, pr)
+		pr.observe(time.Since(start), err)
+
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			return result, err
+		}
+		log.Printf("%s provider %s failed, trying the next one: %v", p.chain, pr.url, err)
+	}
+
+	return result, err
+}
+
+type outcome[T any] struct {
+	result T
+	err    error
+}
+
+// hedged calls fn on the healthiest provider and, whenever no answer arrives
+// within twice its usual latency, on the next provider as well. The first
+// success wins and the other calls are cancelled.
+func hedged[T any](ctx context.Context, p *Pool, fn func(context.Context, *provider) (T, error)) (T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	providers := p.ranked()
+	outcomes := make(chan outcome[T], len(providers))
+
+	launch := func(pr *provider) {
+		go func() {
+			start := time.Now()
+			result, err := fn(ctx, pr)
+			pr.observe(time.Since(start), err)
+			outcomes <- outcome[T]{result, err}
+		}()
+	}
+
+	next, pending := 0, 0
+	var last outcome[T]
+
+	for {
+		var hedge <-chan time.Time
+		if next < len(providers) {
+			if pending == 0 {
+				launch(providers[next])
+				next++
+				pending++
+				continue
+			}
+			hedge = time.After(providers[next-1].hedgeDelay())
+		} else if pending == 0 {
+			return last.result, last.err
+		}
+
+		select {
+		case <-ctx.Done():
+			return last.result, ctx.Err()
+		case <-hedge:
+			launch(providers[next])
+			next++
+			pending++
+		case last = <-outcomes:
+			pending--
+			if last.err == nil || !retryable(last.err) {
+				return last.result, last.err
+			}
+		}
+	}
+}
+
+func (pr *provider) hedgeDelay() time.Duration {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	return max(2*pr.latency, minHedgeDelay)
+}
+
+// agreed calls fn on the quorum healthiest providers at the same block and
+// returns the result once quorum of them match. Whenever a provider fails or
+// disagrees so that the providers still pending cannot complete a quorum, the
+// next provider in health order is asked as well. Results are compared in
+// their encoded form.
+func agreed(ctx context.Context, p *Pool, blockNumber *big.Int, fn func(context.Context, *provider, *big.Int) ([]byte, error)) ([]byte, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	providers := p.ranked()
+
+	// Providers may be at different heads, so reads of the latest block are
+	// pinned to the lowest head among the healthiest providers.
+	if blockNumber == nil {
+		var lowest uint64
+		for _, pr := range providers[:p.quorum] {
+			pr.mu.Lock()
+			if pr.head > 0 && (lowest == 0 || pr.head < lowest) {
+				lowest = pr.head
+			}
+			pr.mu.Unlock()
+		}
+		if lowest > 0 {
+			blockNumber = new(big.Int).SetUint64(lowest)
+		}
+	}
+
+	outcomes := make(chan outcome[[]byte], len(providers))
+	launch := func(pr *provider) {
+		go func() {
+			start := time.Now()
+			result, err := fn(ctx, pr, blockNumber)
+			pr.observe(time.Since(start), err)
+			outcomes <- outcome[[]byte]{result, err}
+		}()
+	}
+
+	next, pending := 0, 0
+	var results [][]byte
+	var lastErr error
+	for {
+		_, votes := plurality(results)
+		for next < len(providers) && votes+pending < p.quorum {
+			launch(providers[next])
+			next++
+			pending++
+		}
+		if pending == 0 {
+			break
+		}
+
+		var o outcome[[]byte]
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case o = <-outcomes:
+		}
+		pending--
+		if o.err != nil {
+			lastErr = o.err
+			continue
+		}
+		results = append(results, o.result)
+		if candidate, votes := plurality(results); votes >= p.quorum {
+			return candidate, nil
+		}
+	}
+
+	if lastErr != nil {
+		return nil, fmt.Errorf("no quorum of %d %s providers: %w", p.quorum, p.chain, lastErr)
+	}
+	return nil, fmt.Errorf("no quorum of %d %s providers: answers differ", p.quorum, p.chain)
+}
+
+// plurality returns the result most of results match and how many do.
+func plurality(results [][]byte) ([]byte, int) {
+	var best []byte
+	bestVotes := 0
+	for _, candidate := range results {
+		votes := 0
+		for _, result := range results {
+			if bytes.Equal(candidate, result) {
+				votes++
+			}
+		}
+		if votes > bestVotes {
+			best, bestVotes = candidate, votes
+		}
+	}
+	return best, bestVotes
+}
+
+func (p *Pool) BlockNumber(ctx context.Context) (uint64, error) {
+	return hedged(ctx, p, func(ctx context.Context, pr *provider) (uint64, error) {
+		return pr.client.BlockNumber(ctx)
+	})
+}
+
+// BlockByNumber and HeaderByNumber move on to the next provider when one has
+// not seen the block yet, and only report ethereum.NotFound when none has.
+func (p *Pool) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	block, err := failover(ctx, p, func(ctx context.Context, pr *provider) (*types.Block, error) {
+		block, err := pr.client.BlockByNumber(ctx, number)
+		return block, unseen(err)
+	})
+	return block, found(err)
+}
+
+func (p *Pool) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	header, err := hedged(ctx, p, func(ctx context.Context, pr *provider) (*types.Header, error) {
+		header, err := pr.client.HeaderByNumber(ctx, number)
+		return header, unseen(err)
+	})
+	return header, found(err)
+}
+
+// CallContext performs a raw JSON-RPC call, hedged across providers. Each
+// provider answers into its own buffer and only the winning answer is
+// decoded into result. A null answer, such as a block the provider has not
+// seen yet, is retried on the other providers and only decoded when all of
+// them return it.
+func (p *Pool) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	raw, err := hedged(ctx, p, func(ctx context.Context, pr *provider) (json.RawMessage, error) {
+		var raw json.RawMessage
+		err := pr.rpc.CallContext(ctx, &raw, method, args...)
+		if err == nil && (len(raw) == 0 || bytes.Equal(raw, []byte("null"))) {
+			err = errUnseen
+		}
+		return raw, err
+	})
+	if errors.Is(err, errUnseen) {
+		raw, err = json.RawMessage("null"), nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, result)
+}
+
+func (p *Pool) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	blockNumber = callBlock(ctx, blockNumber)
+	return hedged(ctx, p, func(ctx context.Context, pr *provider) ([]byte, error) {
+		return pr.client.CodeAt(ctx, contract, blockNumber)
+	})
+}
+
+// CallContract executes an eth_call. Calls made with a Critical context go
+// through the quorum when the pool has one, and calls made with an AtBlock
+// context read the pinned block.
+func (p *Pool) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	blockNumber = callBlock(ctx, blockNumber)
+	if p.quorum > 1 && isCritical(ctx) {
+		return agreed(ctx, p, blockNumber, func(ctx context.Context, pr *provider, blockNumber *big.Int) ([]byte, error) {
+			return pr.client.CallContract(ctx, call, blockNumber)
+		})
+	}
+
+	return hedged(ctx, p, func(ctx context.Context, pr *provider) ([]byte, error) {
+		return pr.client.CallContract(ctx, call, blockNumber)
+	})
+}
+
+// FilterLogs only asks providers whose head has reached query.ToBlock, since
+// one behind it answers with the logs it has seen so far instead of an
+// error.
+func (p *Pool) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	providers := p.ranked()
+	if query.ToBlock != nil && query.ToBlock.Sign() > 0 {
+		providers = p.synced(query.ToBlock.Uint64())
+	}
+	return failoverTo(ctx, p, providers, func(ctx context.Context, pr *provider) ([]types.Log, error) {
+		return pr.client.FilterLogs(ctx, query)
+	})
+}
+
+func (p *Pool) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return failover(ctx, p, func(ctx context.Context, pr *provider) (ethereum.Subscription, error) {
+		return pr.client.SubscribeFilterLogs(ctx, query, ch)
+	})
+}
+
+func (p *Pool) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return failover(ctx, p, func(ctx context.Context, pr *provider) ([]byte, error) {
+		return pr.client.PendingCodeAt(ctx, account)
+	})
+}
+
+func (p *Pool) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	return failover(ctx, p, func(ctx context.Context, pr *provider) (uint64, error) {
+		return pr.client.PendingNonceAt(ctx, account)
+	})
+}
+
+func (p *Pool) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return failover(ctx, p, func(ctx context.Context, pr *provider) (*big.Int, error) {
+		return pr.client.SuggestGasPrice(ctx)
+	})
+}
+
+func (p *Pool) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return failover(ctx, p, func(ctx context.Context, pr *provider) (*big.Int, error) {
+		return pr.client.SuggestGasTipCap(ctx)
+	})
+}
+
+func (p *Pool) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return failover(ctx, p, func(ctx context.Context, pr *provider) (uint64, error) {
+		return pr.client.EstimateGas(ctx, call)
+	})
+}
+
+func (p *Pool) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	_, err := failover(ctx, p, func(ctx context.Context, pr *provider) (struct{}, error) {
+		return struct{}{}, pr.client.SendTransaction(ctx, tx)
+	})
+	return err
+}
@@ -0,0 +1,154 @@
+package rpcpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type codeError struct {
+	code int
+}
+
+func (e codeError) Error() string  { return fmt.Sprintf("error %d", e.code) }
+func (e codeError) ErrorCode() int { return e.code }
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", rpc.HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{"server error", rpc.HTTPError{StatusCode: http.StatusBadGateway}, true},
+		{"bad request", rpc.HTTPError{StatusCode: http.StatusBadRequest}, false},
+		{"limit exceeded", codeError{-32005}, true},
+		{"revert", codeError{3}, false},
+		{"invalid params", codeError{-32602}, false},
+		{"not found", ethereum.NotFound, false},
+		{"not seen yet", errUnseen, true},
+		{"wrapped rate limit", fmt.Errorf("call failed: %w", rpc.HTTPError{StatusCode: http.StatusTooManyRequests}), true},
+		{"transport", errors.New("connection reset by peer"), true},
+		{"timeout", context.DeadlineExceeded, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.want {
+				t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// answer is what a provider returns to a quorum read.
+type answer struct {
+	result string
+	err    error
+}
+
+func TestAgreed(t *testing.T) {
+	failed := errors.New("connection refused")
+
+	tests := []struct {
+		name    string
+		quorum  int
+		answers []answer
+		want    string
+		wantErr bool
+		asked   int
+	}{
+		{"healthiest agree", 2, []answer{{result: "a"}, {result: "a"}, {result: "b"}}, "a", false, 2},
+		{"disagreement asks the next provider", 2, []answer{{result: "a"}, {result: "b"}, {result: "a"}}, "a", false, 3},
+		{"failure asks the next provider", 2, []answer{{err: failed}, {result: "a"}, {result: "a"}}, "a", false, 3},
+		{"quorum of three among five", 3, []answer{{result: "a"}, {result: "b"}, {err: failed}, {result: "a"}, {result: "a"}}, "a", false, 5},
+		{"answers differ", 2, []answer{{result: "a"}, {result: "b"}, {result: "c"}}, "", true, 3},
+		{"every provider fails", 2, []answer{{err: failed}, {err: failed}, {err: failed}}, "", true, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := &Pool{chain: "test", quorum: tt.quorum}
+			answers := make(map[*provider]answer)
+			for i, a := range tt.answers {
+				// Lower latency ranks first, so providers are asked in order.
+				pr := &provider{url: fmt.Sprintf("provider%d", i), latency: time.Duration(i+1) * time.Millisecond}
+				pool.providers = append(pool.providers, pr)
+				answers[pr] = a
+			}
+
+			asked := make(chan *provider, len(tt.answers))
+			result, err := agreed(context.Background(), pool, big.NewInt(1), func(ctx context.Context, pr *provider, blockNumber *big.Int) ([]byte, error) {
+				asked <- pr
+				a := answers[pr]
+				return []byte(a.result), a.err
+			})
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("agreed returned %q, want an error", result)
+				}
+			} else if err != nil || string(result) != tt.want {
+				t.Fatalf("agreed returned %q, %v, want %q", result, err, tt.want)
+			}
+			if len(asked) != tt.asked {
+				t.Errorf("agreed asked %d providers, want %d", len(asked), tt.asked)
+			}
+		})
+	}
+}
+
+func TestAgreedPinsLatestToLowestHead(t *testing.T) {
+	pool := &Pool{chain: "test", quorum: 2}
+	for i, head := range []uint64{105, 103, 90} {
+		pool.providers = append(pool.providers, &provider{
+			url:     fmt.Sprintf("provider%d", i),
+			latency: time.Duration(i+1) * time.Millisecond,
+			head:    head,
+		})
+	}
+
+	_, err := agreed(context.Background(), pool, nil, func(ctx context.Context, pr *provider, blockNumber *big.Int) ([]byte, error) {
+		if blockNumber == nil || blockNumber.Uint64() != 103 {
+			return nil, fmt.Errorf("read block %v, want 103", blockNumber)
+		}
+		return []byte("a"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlurality(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []string
+		want    string
+		votes   int
+	}{
+		{"none", nil, "", 0},
+		{"unanimous", []string{"a", "a", "a"}, "a", 3},
+		{"majority", []string{"b", "a", "a"}, "a", 2},
+		{"all differ", []string{"a", "b", "c"}, "a", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results [][]byte
+			for _, result := range tt.results {
+				results = append(results, []byte(result))
+			}
+			got, votes := plurality(results)
+			if string(got) != tt.want || votes != tt.votes {
+				t.Errorf("plurality(%v) = %q, %d, want %q, %d", tt.results, got, votes, tt.want, tt.votes)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package rpcpool
+
+import "sync"
+
+// Lookup returns the provider pool of a chain, keyed by the chain name used
+// in evm_config.json.
+type Lookup func(chain string) (*Pool, bool)
+
+// Registry holds the provider pool of every chain. Config reloads add chains
+// to it while listeners and background jobs look pools up, so it is safe for
+// concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	pools map[string]*Pool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{pools: make(map[string]*Pool)}
+}
+
+// Get returns the pool of chain. It satisfies Lookup.
+func (r *Registry) Get(chain string) (*Pool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	pool, ok := r.pools[chain]
+	return pool, ok
+}
+
+// Set registers the pool of chain, replacing any previous one.
+func (r *Registry) Set(chain string, pool *Pool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pools[chain] = pool
+}
+
+// Close closes every registered pool.
+func (r *Registry) Close() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, pool := range r.pools {
+		pool.Close()
+	}
+}
@@ -3,81 +3,54 @@ package main
 import (
 	"context"
 	"log"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"dumb-api/config"
+	"dumb-api/internal/pricing"
+	"dumb-api/internal/retention"
 	"dumb-api/internal/services"
 
 	"github.com/gobuffalo/pop/v6"
 )
 
+// The standalone listener keeps its own copy of the graph up to date and
+// publishes every pool change on the pool_updates channel, so API replicas
+// started with LISTENER_MODE=subscribe can apply them without talking to
+// the chain. Run the API with the default LISTENER_MODE=embedded instead
+// when a single process is enough. Either way, the process running the
+// listeners also records the TVL of the pools and the USD prices of their
+// tokens, and applies the retention policies of price history.
+//
+// On SIGTERM or interrupt, listeners finish the block they are applying and
+// checkpoint it before the process exits.
 func main() {
-	avalanche_handler := services.NewAvalancheHandler(config.AVALANCHE_RPC_URL)
-	log.Printf("Listening for events")
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	db, err := pop.Connect(config.ENV)
 	if err != nil {
 		log.Fatalf("Failed to create database connection: %v", err)
 	}
 
-	go blockListener(avalanche_handler, db)
-
-	select {}
-}
-
-func blockListener(handler services.EVMHandler, db *pop.Connection) {
-	lastBlock, _ := handler.LastBlock(context.Background(), db)
-
-	if lastBlock == 0 {
-		block, err := handler.Block(context.Background(), nil)
-		if err != nil {
-			log.Printf("Failed to get latest block - if this isn't the first deploy check the error: %v", err)
-			return
-		}
-		lastBlock = int64(block.NumberU64())
+	_, clients, err := services.BootstrapGraph(ctx)
+	if err != nil {
+		log.Printf("Stopped before the graph was loaded: %v", err)
+		return
 	}
 
-	for {
-		log.Printf("Listening for events")
-		latestBlock, err := handler.Block(context.Background(), nil)
-		if err != nil {
-			log.Printf("Failed to get latest block: %v", err)
-			time.Sleep(5 * time.Second)
-			continue
-		}
-
-		latestBlockNumber := int64(latestBlock.NumberU64())
-
-		if latestBlockNumber <= lastBlock {
-			time.Sleep(1 * time.Second)
-			continue
-		}
-
-		nextBlockNumber := lastBlock + 1
-		block, err := handler.BlockResult(context.Background(), &nextBlockNumber)
-		if err != nil {
-			log.Printf("Failed to get block %d: %v", nextBlockNumber, err)
-			time.Sleep(1 * time.Second)
-			continue
-		}
-
-		err = handler.Listen(db, block)
-		if err != nil {
-			log.Printf("Failed to listen for %s events in block %d: %v", handler.GetChainName(), nextBlockNumber, err)
-		}
-
-		err = handler.UpdateLastBlock(db, nextBlockNumber)
-		if err != nil {
-			log.Printf("Failed to update last block to %d: %v", nextBlockNumber, err)
-		} else {
-			lastBlock = nextBlockNumber
-			log.Printf("Processed block %d", nextBlockNumber)
-		}
-
-		blocksBehind := latestBlockNumber - lastBlock
-		if blocksBehind > 10 {
-			time.Sleep(1 * time.Millisecond)
-		} else {
-			time.Sleep(1 * time.Second)
-		}
+	log.Printf("Listening for events")
+	supervisor := services.InitSupervisor(db, clients.Get, services.NewPoolUpdatePublisher(db))
+	supervisor.Start(ctx)
+	services.NewTVLTracker(db, clients.Get).Start(ctx)
+	pricing.InitEngine(db, clients.Get, services.NewCoinGeckoService().GetTokenPrice).Start(ctx)
+	retention.Start(ctx, db, config.Retention)
+
+	<-ctx.Done()
+	log.Printf("Shutting down listeners")
+	if !supervisor.Wait(services.ShutdownTimeout) {
+		log.Printf("Listeners did not stop within %s", services.ShutdownTimeout)
 	}
+	clients.Close()
 }
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"dumb-api/internal/services"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The replay command reproduces the state of a set of pools over a block
+// range to debug wrong quotes and to check changes to the edge math. It loads
+// the pools as of -from, or from the last line of a -snapshot file written by
+// a previous replay, applies every log up to -to and prints the state of each
+// pool, and optionally a quote, after every block that changed one:
+//
+//	go run ./internal/script/replay -chain avalanche -pools 0xabc,0xdef \
+//		-from 52000000 -to 52000100 -quote 0xtokenIn,0xtokenOut,1000000
+//
+// Output goes to stdout as one JSON document per line. Saving it and passing
+// the line of any block as -snapshot replays again from that block.
+func main() {
+	var (
+		chain    = flag.String("chain", "avalanche", "chain name in evm_config.json")
+		pools    = flag.String("pools", "", "comma separated pool addresses, defaults to every pool of -snapshot")
+		from     = flag.Int64("from", 0, "block to load the on-chain state of the pools at")
+		to       = flag.Int64("to", 0, "last block to replay")
+		snapshot = flag.String("snapshot", "", "file whose last line is the replay output to start from instead of -from")
+		quote    = flag.String("quote", "", "tokenIn,tokenOut,amountIn to quote after every block")
+		output   = flag.String("out", "", "file to write to instead of stdout")
+	)
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	opts := services.ReplayOptions{
+		Chain: *chain,
+		From:  *from,
+		To:    *to,
+	}
+	if *pools != "" {
+		opts.Pools = strings.Split(*pools, ",")
+	}
+
+	if *snapshot != "" {
+		s, err := readSnapshot(*snapshot)
+		if err != nil {
+			log.Fatalf("Failed to read snapshot: %v", err)
+		}
+		opts.Snapshot = s
+	} else if *from == 0 {
+		log.Fatal("Either -from or -snapshot is required")
+	}
+
+	if *quote != "" {
+		parts := strings.Split(*quote, ",")
+		if len(parts) != 3 {
+			log.Fatal("-quote must be tokenIn,tokenOut,amountIn")
+		}
+		amountIn, ok := new(big.Int).SetString(parts[2], 10)
+		if !ok {
+			log.Fatalf("Invalid quote amount %q", parts[2])
+		}
+		opts.TokenIn = common.HexToAddress(parts[0]).Hex()
+		opts.TokenOut = common.HexToAddress(parts[1]).Hex()
+		opts.AmountIn = amountIn
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *output, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if err := services.Replay(ctx, opts, out); err != nil {
+		log.Fatalf("Replay failed: %v", err)
+	}
+}
+
+// readSnapshot reads the last line of path, which is either a whole replay
+// output or a single line taken from one.
+func readSnapshot(path string) (*services.ReplaySnapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var last string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			last = line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if last == "" {
+		return nil, fmt.Errorf("%s is empty", path)
+	}
+
+	var snapshot services.ReplaySnapshot
+	if err := json.Unmarshal([]byte(last), &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
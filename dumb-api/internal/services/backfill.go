@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// backfillThreshold is how many blocks behind the head the listener must
+	// be before ranges are fetched concurrently.
+	backfillThreshold = 2 * maxLogRange
+
+	// backfillWorkers bounds the eth_getLogs requests in flight during a
+	// backfill, and backfillBuffer the fetched ranges waiting to be applied.
+	backfillWorkers = 8
+	backfillBuffer  = 4 * backfillWorkers
+
+	// backfillCheckpointInterval is how often chain_states is updated during
+	// a backfill. Swap and Sync logs carry absolute pool state, so blocks
+	// re-applied after a crash between checkpoints leave the graph unchanged.
+	backfillCheckpointInterval = 10 * time.Second
+)
+
+type fetchedRange struct {
+	from BlockRef
+	to   BlockRef
+	logs []types.Log
+	err  error
+}
+
+// backfill ingests the blocks up to head by fetching ranges concurrently and
+// applying them strictly in order. It returns early, leaving the remaining
+// blocks to ingestRange, when a range fails or does not extend the previous
+// one, so reorgs are handled on the regular path, and once ctx is cancelled.
+// Ranges already applied are checkpointed before returning either way.
+func (l *blockListener) backfill(ctx context.Context, head int64) error {
+	// Applying and checkpointing ranges must survive cancellation, only
+	// fetching stops.
+	applyCtx := context.WithoutCancel(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	start := l.last.Number + 1
+	size := l.logRange
+	count := int((head - start + size) / size)
+
+	log.Printf("Backfilling %s blocks %d-%d in %d ranges", l.handler.GetChainName(), start, head, count)
+	began := time.Now()
+	defer l.status.setState(l.status.snapshot().State)
+	l.status.setState("backfilling")
+
+	results := make([]chan fetchedRange, count)
+	for i := range results {
+		results[i] = make(chan fetchedRange, 1)
+	}
+
+	jobs := make(chan int)
+	window := make(chan struct{}, backfillBuffer)
+
+	go func() {
+		defer close(jobs)
+		for i := 0; i < count; i++ {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for w := 0; w < backfillWorkers; w++ {
+		go func() {
+			for i := range jobs {
+				from := start + int64(i)*size
+				to := min(from+size-1, head)
+				results[i] <- l.fetchRange(ctx, from, to)
+			}
+		}()
+	}
+
+	var err error
+	lastCheckpoint := time.Now()
+	for i := 0; i < count && err == nil; i++ {
+		var result fetchedRange
+		select {
+		case result = <-results[i]:
+			<-window
+		case <-ctx.Done():
+			result.err = ctx.Err()
+		}
+
+		switch {
+		case ctx.Err() != nil:
+			err = ctx.Err()
+		case result.err != nil:
+			err = result.err
+		case !l.extends(result.from):
+			err = fmt.Errorf("block %d does not extend block %d", result.from.Number, l.last.Number)
+		default:
+			l.listen(applyCtx, result.from.Number, result.to, result.logs)
+			if time.Since(lastCheckpoint) > backfillCheckpointInterval {
+				err = l.checkpoint(applyCtx)
+				lastCheckpoint = time.Now()
+			}
+		}
+	}
+
+	if checkpointErr := l.checkpoint(applyCtx); err == nil {
+		err = checkpointErr
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Backfilled %s blocks %d-%d in %s", l.handler.GetChainName(), start, head, time.Since(began).Round(time.Second))
+	return nil
+}
+
+// fetchRange fetches the logs of blocks from to to along with the hashes of
+// both ends, so the applier can check that consecutive ranges link up.
+func (l *blockListener) fetchRange(ctx context.Context, from, to int64) fetchedRange {
+	fromRef, err := l.handler.BlockRef(ctx, from)
+	if err != nil {
+		return fetchedRange{err: err}
+	}
+
+	logs, err := l.fetchLogs(ctx, from, to)
+	if err != nil {
+		return fetchedRange{err: err}
+	}
+
+	toRef := fromRef
+	if to != from {
+		toRef, err = l.handler.BlockRef(ctx, to)
+		if err != nil {
+			return fetchedRange{err: err}
+		}
+	}
+
+	if err := l.checkRange(fromRef, toRef, logs); err != nil {
+		return fetchedRange{err: err}
+	}
+
+	return fetchedRange{from: fromRef, to: toRef, logs: logs}
+}
+
+// fetchLogs fetches the logs of blocks from to to, splitting the range in
+// halves whenever the provider rejects it.
+func (l *blockListener) fetchLogs(ctx context.Context, from, to int64) ([]types.Log, error) {
+	logs, err := l.handler.Logs(ctx, from, to)
+	if err == nil || to-from+1 <= minLogRange {
+		return logs, err
+	}
+
+	mid := from + (to-from)/2
+	first, err := l.fetchLogs(ctx, from, mid)
+	if err != nil {
+		return nil, err
+	}
+	second, err := l.fetchLogs(ctx, mid+1, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(first, second...), nil
+}
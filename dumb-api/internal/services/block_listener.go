@@ -0,0 +1,521 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+	"dumb-api/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gobuffalo/pop/v6"
+)
+
+const (
+	// minLogRange and maxLogRange bound the number of blocks requested per
+	// eth_getLogs call. The range halves whenever the provider rejects a
+	// request and doubles again after each success.
+	minLogRange int64 = 1
+	maxLogRange int64 = 2048
+
+	// subscribeRetryInterval is how long the listener polls after a dropped
+	// WebSocket before trying to subscribe again.
+	subscribeRetryInterval = 30 * time.Second
+
+	// maxConsecutiveFailures is how many polling rounds in a row may fail
+	// before the listener gives up and leaves it to the supervisor to restart
+	// it from the last checkpoint.
+	maxConsecutiveFailures = 10
+)
+
+type blockListener struct {
+	handler EVMHandler
+	db      *pop.Connection
+	// last is the last ingested block. Its hash is zero when unknown, as for
+	// checkpoints written before hashes were tracked.
+	last     BlockRef
+	logRange int64
+	status   *ChainStatus
+}
+
+// RunBlockListener ingests the logs of handler's chain starting after the last
+// checkpoint in chain_states. Handlers implementing LogSubscriber stream new
+// blocks over WebSocket and fall back to polling eth_getLogs while the socket
+// is down. Every block is checked to extend the last one ingested, and pools
+// are rolled back to the fork point when it does not. Progress is reported
+// through status. It returns when the listener cannot make progress, or with
+// ctx's error once ctx is cancelled, and is meant to be run by the Supervisor.
+//
+// Cancellation is only observed between blocks: once the logs of a range are
+// fetched, they are applied and checkpointed in chain_states regardless of
+// ctx, so the checkpoint always matches the state served by the graph.
+func RunBlockListener(ctx context.Context, handler EVMHandler, db *pop.Connection, status *ChainStatus) error {
+	l := &blockListener{
+		handler:  handler,
+		db:       db,
+		logRange: maxLogRange,
+		status:   status,
+	}
+
+	var err error
+	l.last, err = handler.LastBlock(ctx, db)
+	if err != nil {
+		return fmt.Errorf("failed to read %s checkpoint: %w", handler.GetChainName(), err)
+	}
+
+	if l.last.Number == 0 {
+		latest, err := handler.BlockNumber(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get latest %s block: %w", handler.GetChainName(), err)
+		}
+		l.last = BlockRef{Number: latest}
+	}
+	status.advance(l.last.Number)
+
+	subscriber, ok := handler.(LogSubscriber)
+	canSubscribe := ok && subscriber.CanSubscribe()
+	var nextSubscribe time.Time
+	failures := 0
+
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if failures >= maxConsecutiveFailures {
+			return fmt.Errorf("%d consecutive failures, last: %w", failures, err)
+		}
+
+		if canSubscribe && time.Now().After(nextSubscribe) {
+			status.setState("subscribed")
+			err := l.subscribe(ctx, subscriber)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("%s subscription ended, polling for %s: %v", handler.GetChainName(), subscribeRetryInterval, err)
+			nextSubscribe = time.Now().Add(subscribeRetryInterval)
+			continue
+		}
+		status.setState("polling")
+
+		var latestBlockNumber int64
+		latestBlockNumber, err = handler.BlockNumber(ctx)
+		if err != nil {
+			log.Printf("Failed to get latest %s block: %v", handler.GetChainName(), err)
+			failures++
+			sleep(ctx, 5*time.Second)
+			continue
+		}
+		status.setHead(latestBlockNumber)
+
+		if latestBlockNumber <= l.last.Number {
+			failures = 0
+			sleep(ctx, handler.GetBlockTime())
+			continue
+		}
+
+		if err = l.catchUp(ctx, latestBlockNumber); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("%v", err)
+			failures++
+			sleep(ctx, handler.GetBlockTime())
+			continue
+		}
+		failures = 0
+	}
+}
+
+// ingestRange fetches and applies the next range of blocks up to head,
+// adapting the range size to what the provider accepts. A range whose first
+// block does not extend the last ingested one triggers a rollback instead.
+func (l *blockListener) ingestRange(ctx context.Context, head int64) error {
+	from := l.last.Number + 1
+	to := from + l.logRange - 1
+	if to > head {
+		to = head
+	}
+
+	fromRef, err := l.handler.BlockRef(ctx, from)
+	if err != nil {
+		return err
+	}
+	if !l.extends(fromRef) {
+		return l.rollback(ctx, fromRef)
+	}
+
+	logs, err := l.handler.Logs(ctx, from, to)
+	if err != nil {
+		if l.logRange > minLogRange {
+			l.logRange = max(l.logRange/2, minLogRange)
+			log.Printf("Shrinking %s log range to %d blocks: %v", l.handler.GetChainName(), l.logRange, err)
+			return nil
+		}
+		return fmt.Errorf("failed to get %s logs for block %d: %w", l.handler.GetChainName(), from, err)
+	}
+
+	if l.logRange < maxLogRange {
+		l.logRange = min(l.logRange*2, maxLogRange)
+	}
+
+	toRef := fromRef
+	if to != from {
+		toRef, err = l.handler.BlockRef(ctx, to)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := l.checkRange(fromRef, toRef, logs); err != nil {
+		return err
+	}
+
+	return l.apply(ctx, from, toRef, logs)
+}
+
+// checkRange fails when logs of the first or last block of a range carry
+// other hashes than from and to, meaning a reorg happened while the range
+// was being fetched. The range is fetched again on the next call.
+func (l *blockListener) checkRange(from, to BlockRef, logs []types.Log) error {
+	for _, vLog := range logs {
+		number := int64(vLog.BlockNumber)
+		if (number == from.Number && vLog.BlockHash != from.Hash) || (number == to.Number && vLog.BlockHash != to.Hash) {
+			return fmt.Errorf("%s blocks %d-%d changed while being fetched", l.handler.GetChainName(), from.Number, to.Number)
+		}
+	}
+	return nil
+}
+
+// extends reports whether block is the child of the last ingested block.
+func (l *blockListener) extends(block BlockRef) bool {
+	return l.last.Hash == (common.Hash{}) || block.ParentHash == l.last.Hash
+}
+
+// rollback handles a reorg detected at block. It walks the stored hashes back
+// to the newest one still canonical, restores pool state as of that block and
+// rewinds the checkpoint to it so the canonical blocks after it are ingested
+// again. Reorgs deeper than the stored hashes resync every pool of the chain
+// from the current on-chain state and resume from the head.
+func (l *blockListener) rollback(ctx context.Context, block BlockRef) error {
+	log.Printf("Reorg detected on %s at block %d", l.handler.GetChainName(), block.Number)
+
+	var stored models.BlockHashes
+	err := l.db.WithContext(ctx).Where("chain_id = ? AND block_number < ?", l.handler.GetChainID(), block.Number).
+		Order("block_number desc").All(&stored)
+	if err != nil {
+		return fmt.Errorf("failed to read %s block hashes: %w", l.handler.GetChainName(), err)
+	}
+
+	for _, s := range stored {
+		canonical, err := l.handler.BlockRef(ctx, s.BlockNumber)
+		if err != nil {
+			return err
+		}
+		if canonical.Hash != common.HexToHash(s.BlockHash) {
+			continue
+		}
+
+		// The rollback and its checkpoint must not be separated by a
+		// shutdown.
+		ctx := context.WithoutCancel(ctx)
+		if err := l.handler.Rollback(ctx, l.db, canonical.Number); err != nil {
+			return fmt.Errorf("failed to roll back %s to block %d: %w", l.handler.GetChainName(), canonical.Number, err)
+		}
+		if err := l.handler.UpdateLastBlock(ctx, l.db, canonical); err != nil {
+			return fmt.Errorf("failed to update last block to %d: %w", canonical.Number, err)
+		}
+		log.Printf("Rewound %s from block %d to %d", l.handler.GetChainName(), l.last.Number, canonical.Number)
+		l.last = canonical
+		l.status.advance(canonical.Number)
+		return nil
+	}
+
+	log.Printf("No common ancestor within %d stored %s blocks, resyncing pools", len(stored), l.handler.GetChainName())
+
+	head, err := l.handler.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	headRef, err := l.handler.BlockRef(ctx, head)
+	if err != nil {
+		return err
+	}
+
+	resyncPools(ctx, strings.ToLower(l.handler.GetChainName()))
+	// A partial resync is discarded with the process, leaving the old
+	// checkpoint for the next start to detect the reorg again.
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if err := l.handler.UpdateLastBlock(context.WithoutCancel(ctx), l.db, headRef); err != nil {
+		return fmt.Errorf("failed to update last block to %d: %w", headRef.Number, err)
+	}
+	l.last = headRef
+	l.status.advance(headRef.Number)
+	return nil
+}
+
+// resyncPools rebuilds the edges of every pool of chain in the latest and
+// finalized graphs from its current on-chain state. It stops at the first
+// pool after ctx is cancelled.
+func resyncPools(ctx context.Context, chain string) {
+	g := graph.GetGlobalGraph()
+	if g == nil {
+		return
+	}
+	finalized := graph.GetFinalizedGraph()
+
+	var pools []*graph.Pool
+	g.Mu.RLock()
+	for _, pool := range g.Pools {
+		if pool.Chain == chain {
+			pools = append(pools, pool)
+		}
+	}
+	g.Mu.RUnlock()
+
+	for _, pool := range pools {
+		if ctx.Err() != nil {
+			return
+		}
+
+		adapter := dexes.AdapterFor(pool)
+		if adapter == nil {
+			continue
+		}
+
+		edge01, edge10, err := adapter.BuildEdges(ctx, pool)
+		if err != nil {
+			log.Printf("Failed to resync pool %s: %v", pool.Pair, err)
+			continue
+		}
+
+		for _, target := range []*graph.Graph{g, finalized} {
+			if target == nil {
+				continue
+			}
+			target.Mu.Lock()
+			if target.HasPool(pool.Pair) {
+				if edge01 != nil {
+					target.NewEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain, edge01.Copy())
+				}
+				if edge10 != nil {
+					target.NewEdge(pool.Token1, pool.Token0, pool.Pair, pool.Chain, edge10.Copy())
+				}
+			}
+			target.Mu.Unlock()
+		}
+	}
+}
+
+// reingest rolls pools back to the block before the one of vLog and ingests
+// the blocks up to the current position again with eth_getLogs, which
+// includes vLog. Logs of orphaned blocks, and blocks too old to roll back,
+// are dropped.
+func (l *blockListener) reingest(ctx context.Context, vLog types.Log) error {
+	block := int64(vLog.BlockNumber)
+	target := l.last.Number
+	if target-block >= ReorgWindow {
+		log.Printf("Dropping late %s log for block %d, already at %d", l.handler.GetChainName(), block, target)
+		return nil
+	}
+
+	canonical, err := l.handler.BlockRef(ctx, block)
+	if err != nil {
+		return err
+	}
+	if canonical.Hash != vLog.BlockHash {
+		return nil
+	}
+	parent, err := l.handler.BlockRef(ctx, block-1)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Late %s log for block %d, ingesting blocks %d-%d again", l.handler.GetChainName(), block, block, target)
+	// The rollback and its checkpoint must not be separated by a shutdown.
+	rollbackCtx := context.WithoutCancel(ctx)
+	if err := l.handler.Rollback(rollbackCtx, l.db, parent.Number); err != nil {
+		return fmt.Errorf("failed to roll back %s to block %d: %w", l.handler.GetChainName(), parent.Number, err)
+	}
+	if err := l.handler.UpdateLastBlock(rollbackCtx, l.db, parent); err != nil {
+		return fmt.Errorf("failed to update last block to %d: %w", parent.Number, err)
+	}
+	l.last = parent
+	l.status.advance(parent.Number)
+
+	return l.catchUp(ctx, target)
+}
+
+// catchUp ingests every block up to head, backfilling concurrently while
+// the listener is far behind.
+func (l *blockListener) catchUp(ctx context.Context, head int64) error {
+	if head-l.last.Number > backfillThreshold {
+		if err := l.backfill(ctx, head); err != nil {
+			log.Printf("Backfill of %s stopped at block %d: %v", l.handler.GetChainName(), l.last.Number, err)
+		}
+	}
+
+	for l.last.Number < head {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := l.ingestRange(ctx, head); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply applies logs and checkpoints to. Both steps run to completion even
+// when ctx is cancelled, so a shutdown never leaves a block half applied.
+func (l *blockListener) apply(ctx context.Context, from int64, to BlockRef, logs []types.Log) error {
+	ctx = context.WithoutCancel(ctx)
+	l.listen(ctx, from, to, logs)
+	return l.checkpoint(ctx)
+}
+
+// listen applies the logs of blocks from to to.Number to the graph and
+// advances the in-memory position without checkpointing it.
+func (l *blockListener) listen(ctx context.Context, from int64, to BlockRef, logs []types.Log) {
+	err := l.handler.Listen(ctx, l.db, logs)
+	if err != nil {
+		log.Printf("Failed to listen for %s events in blocks %d-%d: %v", l.handler.GetChainName(), from, to.Number, err)
+	}
+
+	l.last = to
+	l.status.advance(to.Number)
+	log.Printf("Processed blocks %d-%d (%d logs)", from, to.Number, len(logs))
+
+	final := to.Number - l.handler.GetConfirmations()
+	if err := l.handler.Finalize(ctx, l.db, final); err != nil {
+		log.Printf("Failed to finalize %s block %d: %v", l.handler.GetChainName(), final, err)
+		return
+	}
+	l.status.finalize(final)
+}
+
+// checkpoint persists the in-memory position in chain_states.
+func (l *blockListener) checkpoint(ctx context.Context) error {
+	if err := l.handler.UpdateLastBlock(ctx, l.db, l.last); err != nil {
+		return fmt.Errorf("failed to update last block to %d: %w", l.last.Number, err)
+	}
+	return nil
+}
+
+// subscribe streams heads and logs until the subscription fails. Logs are
+// buffered per block and applied once the head that includes them arrives.
+// Whenever heads skip a block, as after the initial subscription or a missed
+// notification, the gap between chain_states and the head is filled with
+// eth_getLogs instead, discarding buffered logs for those blocks. A head that
+// does not extend the last ingested block rolls pools back to the fork point
+// and re-ingests the canonical blocks the same way, as does a log arriving
+// after the head of its block. It returns ctx's error once ctx is
+// cancelled.
+func (l *blockListener) subscribe(ctx context.Context, subscriber LogSubscriber) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	heads := make(chan BlockRef, 16)
+	logs := make(chan types.Log, 256)
+
+	sub, err := subscriber.Subscribe(ctx, heads, logs)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	log.Printf("Subscribed to %s heads and logs", l.handler.GetChainName())
+
+	pending := make(map[int64][]types.Log)
+	// Blocks up to caughtUp were ingested with eth_getLogs, so streamed logs
+	// for them are duplicates.
+	caughtUp := l.last.Number
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-sub.Err():
+			return err
+		case vLog := <-logs:
+			block := int64(vLog.BlockNumber)
+			switch {
+			case block > l.last.Number:
+				pending[block] = append(pending[block], vLog)
+			case block > caughtUp:
+				// Heads and logs are separate subscriptions, so logs can
+				// trail the head of their block. Logs after it in the same
+				// block or later blocks may have changed the pool since, so
+				// the blocks from the log's on are ingested again with it,
+				// in log order.
+				if err := l.reingest(ctx, vLog); err != nil {
+					return err
+				}
+				caughtUp = l.last.Number
+			}
+		case head := <-heads:
+			number := head.Number
+			l.status.setHead(number)
+			if number < l.last.Number || (number == l.last.Number && head.Hash == l.last.Hash) {
+				continue
+			}
+
+			if number > l.last.Number+1 {
+				for block := range pending {
+					if block < number {
+						delete(pending, block)
+					}
+				}
+				if err := l.catchUp(ctx, number-1); err != nil {
+					return err
+				}
+				caughtUp = l.last.Number
+			}
+
+			if number == l.last.Number || !l.extends(head) {
+				if err := l.rollback(ctx, head); err != nil {
+					return err
+				}
+				pending = make(map[int64][]types.Log)
+				if err := l.catchUp(ctx, number); err != nil {
+					return err
+				}
+				caughtUp = l.last.Number
+				continue
+			}
+
+			// Buffered logs of a block orphaned at the same height are
+			// dropped, the canonical ones carry the head's hash.
+			var blockLogs []types.Log
+			for _, vLog := range pending[number] {
+				if vLog.BlockHash == head.Hash {
+					blockLogs = append(blockLogs, vLog)
+				}
+			}
+			delete(pending, number)
+			sort.Slice(blockLogs, func(i, j int) bool {
+				return blockLogs[i].Index < blockLogs[j].Index
+			})
+
+			if err := l.apply(ctx, number, head, blockLogs); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sleep waits for d or until ctx is cancelled.
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"dumb-api/config"
+	"dumb-api/internal/dexes"
+	_ "dumb-api/internal/dexes/uniswapv2"
+	_ "dumb-api/internal/dexes/uniswapv3"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/graph/edges"
+	"dumb-api/internal/rpcpool"
+)
+
+type chainGraph struct {
+	client *rpcpool.Pool
+	graph  *graph.Graph
+}
+
+// BootstrapGraph discovers the pools of every configured chain concurrently
+// and loads them into the global graph. It returns the registry of the RPC
+// provider pool of each chain. A chain that
+// fails to bootstrap is logged and left out. It fails with ctx's error when
+// ctx is cancelled before every chain is loaded.
+func BootstrapGraph(ctx context.Context) (*graph.Graph, *rpcpool.Registry, error) {
+	globalGraph := graph.InitGlobalGraph()
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		chains = make(map[string]chainGraph)
+	)
+
+	for chainName, chainConfig := range config.GetEVMConfig() {
+		rpcURLs := config.RPCURLs(chainName, chainConfig)
+		if len(rpcURLs) == 0 {
+			log.Printf("No RPC URL configured for %s, skipping", chainName)
+			continue
+		}
+
+		wg.Add(1)
+		go func(chainName string, chainConfig config.ChainConfig) {
+			defer wg.Done()
+
+			result, err := bootstrapChain(ctx, chainName, chainConfig, rpcURLs)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to bootstrap %s, skipping: %v", chainName, err)
+				return
+			}
+
+			mu.Lock()
+			chains[chainName] = result
+			mu.Unlock()
+		}(chainName, chainConfig)
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		for _, result := range chains {
+			result.client.Close()
+		}
+		return nil, nil, ctx.Err()
+	}
+
+	clients := rpcpool.NewRegistry()
+
+	globalGraph.Mu.Lock()
+
+	for chainName, result := range chains {
+		globalGraph.Merge(result.graph)
+		clients.Set(chainName, result.client)
+	}
+
+	edges.AddBridges(globalGraph)
+	graph.InitFinalizedGraph()
+
+	globalGraph.Mu.Unlock()
+
+	return globalGraph, clients, nil
+}
+
+// bootstrapChain discovers the pools of every DEX configured for a chain.
+func bootstrapChain(ctx context.Context, chainName string, chainConfig config.ChainConfig, rpcURLs []string) (chainGraph, error) {
+	client, err := rpcpool.Dial(ctx, chainName, rpcURLs, chainConfig.RpcQuorum)
+	if err != nil {
+		return chainGraph{}, fmt.Errorf("failed to connect to %s network: %w", chainName, err)
+	}
+
+	chain := strings.ToLower(chainName)
+	staged := graph.NewGraph()
+
+	for _, dexConfig := range chainConfig.DexConfigs() {
+		adapter, err := dexes.NewAdapter(chain, dexConfig, client)
+		if err != nil {
+			log.Printf("Skipping %s DEX on %s: %v", dexConfig.Type, chainName, err)
+			continue
+		}
+
+		dexGraph := dexes.Bootstrap(ctx, adapter, tokenAddresses(chainConfig.Tokens), nil)
+		staged.Merge(dexGraph)
+
+		log.Printf("Bootstrapped %s on %s: %d pools", dexConfig.Type, chainName, len(dexGraph.Pools))
+	}
+
+	return chainGraph{client: client, graph: staged}, nil
+}
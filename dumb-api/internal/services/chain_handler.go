@@ -0,0 +1,735 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dumb-api/config"
+	"dumb-api/internal/candles"
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/graph/edges"
+	"dumb-api/internal/history"
+	"dumb-api/internal/pricing"
+	"dumb-api/internal/rpcpool"
+	"dumb-api/internal/streams"
+	"dumb-api/internal/volume"
+	"dumb-api/models"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+)
+
+// defaultBlockTime paces polling on chains without a configured blockTime.
+const defaultBlockTime = time.Second
+
+// ChainHandler ingests the logs of one chain configured in evm_config.json.
+type ChainHandler struct {
+	Client  rpcpool.Client
+	ChainID string
+	// Name is the chain's key in evm_config.json.
+	Name string
+	// Chain is the lowercase name the graph keys the chain's pools by.
+	Chain string
+	// WSURL enables eth_subscribe based ingestion when set.
+	WSURL         string
+	Confirmations int64
+	BlockTime     time.Duration
+	// Publisher, when set, receives the state of every pool a block touched.
+	Publisher *PoolUpdatePublisher
+
+	journal stateJournal
+	// finalized is the last block applied to the finalized graph.
+	finalized int64
+	// lastBlockTime caches the timestamp of the last block swaps were
+	// recorded for, since subscriptions deliver logs one at a time.
+	lastBlockTime BlockRef
+	// lastCheckpoint is when the state of every pool of the chain was last
+	// stored in the pool state history.
+	lastCheckpoint time.Time
+}
+
+func NewChainHandler(name string, chainConfig config.ChainConfig, client rpcpool.Client) *ChainHandler {
+	blockTime := time.Duration(chainConfig.BlockTime * float64(time.Second))
+	if blockTime <= 0 {
+		blockTime = defaultBlockTime
+	}
+
+	return &ChainHandler{
+		Client:        client,
+		ChainID:       strconv.Itoa(chainConfig.ChainId),
+		Name:          name,
+		Chain:         strings.ToLower(name),
+		WSURL:         config.WSURL(name, chainConfig),
+		Confirmations: chainConfig.Confirmations,
+		BlockTime:     blockTime,
+	}
+}
+
+// UpdateLastBlock checkpoints block in chain_states and records its hash in
+// block_hashes, dropping hashes older than ReorgWindow.
+func (h *ChainHandler) UpdateLastBlock(ctx context.Context, db *pop.Connection, block BlockRef) error {
+	db = db.WithContext(ctx)
+	if err := h.recordBlockHash(db, block); err != nil {
+		return err
+	}
+
+	var chainState models.ChainState
+
+	err := db.Where("chain_id = ?", h.ChainID).First(&chainState)
+	if err != nil {
+		chainState = models.ChainState{
+			ID:            uuid.Must(uuid.NewV4()),
+			ChainID:       h.ChainID,
+			LastBlock:     block.Number,
+			LastBlockHash: block.Hash.Hex(),
+			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
+		}
+
+		verrs, err := db.ValidateAndCreate(&chainState)
+		if err != nil {
+			return fmt.Errorf("failed to create chain state: %v", err)
+		}
+		if verrs.HasAny() {
+			return fmt.Errorf("validation errors creating chain state: %v", verrs.Errors)
+		}
+		return nil
+	}
+
+	chainState.LastBlock = block.Number
+	chainState.LastBlockHash = block.Hash.Hex()
+	chainState.UpdatedAt = time.Now()
+
+	verrs, err := db.ValidateAndUpdate(&chainState)
+	if err != nil {
+		return fmt.Errorf("failed to update chain state: %v", err)
+	}
+	if verrs.HasAny() {
+		return fmt.Errorf("validation errors updating chain state: %v", verrs.Errors)
+	}
+
+	return nil
+}
+
+func (h *ChainHandler) recordBlockHash(db *pop.Connection, block BlockRef) error {
+	err := db.RawQuery(
+		`INSERT INTO block_hashes (chain_id, block_number, block_hash, parent_hash, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (chain_id, block_number)
+		DO UPDATE SET block_hash = EXCLUDED.block_hash, parent_hash = EXCLUDED.parent_hash, created_at = EXCLUDED.created_at`,
+		h.ChainID, block.Number, block.Hash.Hex(), block.ParentHash.Hex(), time.Now(),
+	).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to record hash of block %d: %v", block.Number, err)
+	}
+
+	// Hashes after block belong to an abandoned fork once a rollback
+	// checkpoints an earlier block.
+	err = db.RawQuery(
+		"DELETE FROM block_hashes WHERE chain_id = ? AND (block_number > ? OR block_number < ?)",
+		h.ChainID, block.Number, block.Number-ReorgWindow,
+	).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to prune block hashes: %v", err)
+	}
+
+	return nil
+}
+
+func (h *ChainHandler) LastBlock(ctx context.Context, db *pop.Connection) (BlockRef, error) {
+	var chainState models.ChainState
+
+	err := db.WithContext(ctx).Where("chain_id = ?", h.ChainID).First(&chainState)
+	if err != nil {
+		return BlockRef{}, nil
+	}
+
+	block := BlockRef{Number: chainState.LastBlock}
+	if chainState.LastBlockHash != "" {
+		block.Hash = common.HexToHash(chainState.LastBlockHash)
+	}
+
+	return block, nil
+}
+
+func (h *ChainHandler) Block(ctx context.Context, height *int64) (*types.Block, error) {
+	var blockNumber *big.Int
+	if height != nil {
+		blockNumber = big.NewInt(*height)
+	}
+
+	block, err := h.Client.BlockByNumber(ctx, blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block: %v", err)
+	}
+
+	return block, nil
+}
+
+func (h *ChainHandler) BlockRef(ctx context.Context, number int64) (BlockRef, error) {
+	var block *BlockRef
+	err := h.Client.CallContext(ctx, &block, "eth_getBlockByNumber", hexutil.EncodeBig(big.NewInt(number)), false)
+	if err != nil {
+		return BlockRef{}, fmt.Errorf("failed to get block %d: %v", number, err)
+	}
+	if block == nil {
+		return BlockRef{}, fmt.Errorf("block %d not found", number)
+	}
+
+	return *block, nil
+}
+
+func (h *ChainHandler) BlockNumber(ctx context.Context) (int64, error) {
+	number, err := h.Client.BlockNumber(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get block number: %v", err)
+	}
+
+	return int64(number), nil
+}
+
+// Logs returns the logs emitted between from and to (inclusive) by the pools
+// tracked on this chain, restricted to the topics their adapters handle.
+func (h *ChainHandler) Logs(ctx context.Context, from, to int64) ([]types.Log, error) {
+	query, ok, err := h.filterQuery()
+	if err != nil || !ok {
+		return nil, err
+	}
+	query.FromBlock = big.NewInt(from)
+	query.ToBlock = big.NewInt(to)
+
+	logs, err := h.Client.FilterLogs(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logs for blocks %d-%d: %v", from, to, err)
+	}
+
+	return logs, nil
+}
+
+func (h *ChainHandler) CanSubscribe() bool {
+	return h.WSURL != ""
+}
+
+// Subscribe streams new heads and the logs of tracked pools over WebSocket.
+// The subscription fails when the socket drops or when the set of tracked
+// pools changes, so callers resubscribe with an up to date filter.
+func (h *ChainHandler) Subscribe(ctx context.Context, heads chan<- BlockRef, logs chan<- types.Log) (ethereum.Subscription, error) {
+	query, _, err := h.filterQuery()
+	if err != nil {
+		return nil, err
+	}
+	tracked := len(query.Addresses)
+
+	client, err := rpc.DialContext(ctx, h.WSURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", h.WSURL, err)
+	}
+
+	headSub, err := client.EthSubscribe(ctx, heads, "newHeads")
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to subscribe to new heads: %v", err)
+	}
+
+	var logSub ethereum.Subscription
+	if tracked > 0 {
+		logSub, err = ethclient.NewClient(client).SubscribeFilterLogs(ctx, query, logs)
+		if err != nil {
+			headSub.Unsubscribe()
+			client.Close()
+			return nil, fmt.Errorf("failed to subscribe to logs: %v", err)
+		}
+	}
+
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer client.Close()
+		defer headSub.Unsubscribe()
+		var logErr <-chan error
+		if logSub != nil {
+			defer logSub.Unsubscribe()
+			logErr = logSub.Err()
+		}
+
+		check := time.NewTicker(30 * time.Second)
+		defer check.Stop()
+
+		for {
+			select {
+			case <-quit:
+				return nil
+			case err := <-headSub.Err():
+				return err
+			case err := <-logErr:
+				return err
+			case <-check.C:
+				if query, _, err := h.filterQuery(); err == nil && len(query.Addresses) != tracked {
+					return errTrackedPoolsChanged
+				}
+			}
+		}
+	}), nil
+}
+
+// filterQuery returns a log filter matching the tracked pools of this chain
+// and the topics their adapters handle. ok is false when no pool is tracked.
+func (h *ChainHandler) filterQuery() (query ethereum.FilterQuery, ok bool, err error) {
+	g := graph.GetGlobalGraph()
+	if g == nil {
+		return query, false, fmt.Errorf("graph not initialized")
+	}
+
+	g.Mu.RLock()
+	for _, pool := range g.Pools {
+		if pool.Chain == h.Chain {
+			query.Addresses = append(query.Addresses, common.HexToAddress(pool.Pair))
+		}
+	}
+	g.Mu.RUnlock()
+
+	if len(query.Addresses) == 0 {
+		return query, false, nil
+	}
+
+	var topics []common.Hash
+	for _, adapter := range dexes.ChainAdapters(h.Chain) {
+		topics = append(topics, adapter.Topics()...)
+	}
+	query.Topics = [][]common.Hash{topics}
+
+	return query, true, nil
+}
+
+// Listen applies logs, in order, to the global graph. They are applied under a
+// single write lock, so quotes never observe a partially applied range. The
+// state of each pool before every block that changes it is journaled so the
+// block can be rolled back, and its state after every such block is stored in
+// the pool state history.
+func (h *ChainHandler) Listen(ctx context.Context, db *pop.Connection, logs []types.Log) error {
+	g := graph.GetGlobalGraph()
+	if g == nil {
+		return fmt.Errorf("graph not initialized")
+	}
+
+	touched := make(map[string]*graph.Pool)
+	lastBlock := make(map[string]int64)
+	var newestBlock int64
+	var swaps []decodedSwap
+	var samples []*graph.PriceSample
+	var states []*models.PoolHistory
+
+	// Nothing is written to the database until the lock is released, so
+	// quotes are not held up by its round trips.
+	g.Mu.Lock()
+	for _, vLog := range logs {
+		if len(vLog.Topics) == 0 || vLog.Removed {
+			continue
+		}
+
+		// Logs are routed to the adapter owning the emitting pool, which
+		// knows which of its topics change pool state.
+		pool := g.GetPool(vLog.Address.Hex())
+		if pool == nil || pool.Chain != h.Chain {
+			continue
+		}
+
+		adapter := dexes.AdapterFor(pool)
+		if adapter == nil {
+			log.Printf("No adapter registered for pool %s (%s)", pool.Pair, pool.Dex)
+			continue
+		}
+
+		if !hasTopic(adapter.Topics(), vLog.Topics[0]) {
+			continue
+		}
+
+		block := int64(vLog.BlockNumber)
+		if _, ok := touched[pool.Pair]; !ok || lastBlock[pool.Pair] != block {
+			if state, err := adapter.ExportState(g, pool); err != nil {
+				log.Printf("Failed to journal pool %s at block %d: %v", pool.Pair, block, err)
+			} else {
+				h.journal.record(block, pool, state)
+				// The state before this block is the state after the
+				// previous block of the range that changed the pool.
+				if ok {
+					states = append(states, newPoolHistory(pool, lastBlock[pool.Pair], state, false))
+				}
+			}
+		}
+
+		samples = append(samples, adapter.ApplyLog(g, pool, vLog)...)
+		if decoder, ok := adapter.(dexes.SwapDecoder); ok {
+			if swap, ok := decoder.DecodeSwap(vLog); ok {
+				swaps = append(swaps, decodedSwap{pool: pool, log: vLog, swap: swap})
+			}
+		}
+		touched[pool.Pair] = pool
+		lastBlock[pool.Pair] = block
+		newestBlock = max(newestBlock, block)
+	}
+	g.Mu.Unlock()
+
+	// Entries after the finalized block are still needed to derive the
+	// finalized view.
+	h.journal.prune(min(newestBlock-ReorgWindow, h.finalized))
+
+	changed := make([]*graph.Pool, 0, len(touched))
+	for _, pool := range touched {
+		changed = append(changed, pool)
+	}
+	pricing.Touch(changed...)
+	if len(changed) > 0 {
+		streams.Notify(h.Chain, newestBlock, changed...)
+	}
+
+	checkpoint := len(touched) > 0 && time.Since(h.lastCheckpoint) >= history.CheckpointInterval
+	if len(touched) > 0 {
+		g.Mu.RLock()
+		states = append(states, h.exportStates(g, touched, lastBlock, newestBlock, checkpoint)...)
+		g.Mu.RUnlock()
+	}
+	if h.record(ctx, db, swaps, samples, states) && checkpoint {
+		h.lastCheckpoint = time.Now()
+	}
+
+	if h.Publisher != nil && len(touched) > 0 {
+		g.Mu.RLock()
+		for _, pool := range touched {
+			if err := h.Publisher.Publish(ctx, g, pool, lastBlock[pool.Pair], false); err != nil {
+				log.Printf("Failed to publish update of pool %s: %v", pool.Pair, err)
+			}
+		}
+		g.Mu.RUnlock()
+	}
+
+	return nil
+}
+
+// Rollback imports the journaled state of every pool changed after block and
+// publishes the restored states. The swaps, price ticks and pool history of
+// the orphaned blocks are deleted, and the candles they were counted in are
+// rebuilt. A reorg deeper than the confirmation depth also reverts the
+// finalized graph.
+func (h *ChainHandler) Rollback(ctx context.Context, db *pop.Connection, block int64) error {
+	g := graph.GetGlobalGraph()
+	if g == nil {
+		return fmt.Errorf("graph not initialized")
+	}
+
+	restored := make(map[string][]byte)
+	pools := make(map[string]*graph.Pool)
+
+	g.Mu.Lock()
+	for _, entry := range h.journal.rewind(block) {
+		pool := entry.pool
+		if !g.HasPool(pool.Pair) {
+			continue
+		}
+
+		if err := importState(g, pool, entry.state); err != nil {
+			log.Printf("Failed to restore pool %s to block %d: %v", pool.Pair, block, err)
+			continue
+		}
+		restored[pool.Pair] = entry.state
+		pools[pool.Pair] = pool
+	}
+	g.Mu.Unlock()
+
+	log.Printf("Rolled back %d %s pools to block %d", len(restored), h.GetChainName(), block)
+	restoredPools := make([]*graph.Pool, 0, len(pools))
+	for _, pool := range pools {
+		restoredPools = append(restoredPools, pool)
+	}
+	pricing.Touch(restoredPools...)
+	streams.Notify(h.Chain, block, restoredPools...)
+
+	err := db.WithContext(ctx).Transaction(func(tx *pop.Connection) error {
+		if err := volume.Rollback(tx, h.Chain, block); err != nil {
+			return err
+		}
+		if err := history.Rollback(tx, h.Chain, block); err != nil {
+			return err
+		}
+		return candles.Rollback(tx, h.Chain, block)
+	})
+	if err != nil {
+		log.Print(err)
+	}
+	// The last checkpoint may have been taken after block.
+	h.lastCheckpoint = time.Time{}
+
+	if h.Publisher != nil && len(restored) > 0 {
+		g.Mu.RLock()
+		for _, pool := range pools {
+			if err := h.Publisher.Publish(ctx, g, pool, block, false); err != nil {
+				log.Printf("Failed to publish rollback of pool %s: %v", pool.Pair, err)
+			}
+		}
+		g.Mu.RUnlock()
+	}
+
+	if block < h.finalized {
+		log.Printf("Reorg of %s reverted finalized block %d to %d", h.GetChainName(), h.finalized, block)
+		h.finalized = block
+		h.publishFinalized(ctx, pools, restored)
+	}
+
+	return nil
+}
+
+// Finalize brings the finalized graph up to block. The state of each pool
+// changed since the previous finalized block is the state it had right
+// after block, taken from the journal when later blocks changed it again
+// and from the latest graph otherwise.
+func (h *ChainHandler) Finalize(ctx context.Context, db *pop.Connection, block int64) error {
+	if block <= h.finalized {
+		return nil
+	}
+
+	g := graph.GetGlobalGraph()
+	if g == nil {
+		return fmt.Errorf("graph not initialized")
+	}
+
+	pools := make(map[string]*graph.Pool)
+	states := make(map[string][]byte)
+
+	g.Mu.RLock()
+	for _, pool := range h.journal.changed(h.finalized, block) {
+		state, ok := h.journal.stateAfter(pool.Pair, block)
+		if !ok {
+			adapter := dexes.AdapterFor(pool)
+			if adapter == nil || !g.HasPool(pool.Pair) {
+				continue
+			}
+			var err error
+			state, err = adapter.ExportState(g, pool)
+			if err != nil {
+				log.Printf("Failed to export pool %s for finalization: %v", pool.Pair, err)
+				continue
+			}
+		}
+		pools[pool.Pair] = pool
+		states[pool.Pair] = state
+	}
+	g.Mu.RUnlock()
+
+	h.finalized = block
+	h.publishFinalized(ctx, pools, states)
+
+	return nil
+}
+
+// publishFinalized imports states into the finalized graph and publishes
+// them as finalized updates.
+func (h *ChainHandler) publishFinalized(ctx context.Context, pools map[string]*graph.Pool, states map[string][]byte) {
+	finalized := graph.GetFinalizedGraph()
+	if finalized == nil || len(states) == 0 {
+		return
+	}
+
+	finalized.Mu.Lock()
+	for pair, state := range states {
+		if err := importState(finalized, pools[pair], state); err != nil {
+			log.Printf("Failed to finalize pool %s: %v", pair, err)
+		}
+	}
+	finalized.Mu.Unlock()
+
+	if h.Publisher != nil {
+		finalized.Mu.RLock()
+		for _, pool := range pools {
+			if err := h.Publisher.Publish(ctx, finalized, pool, h.finalized, true); err != nil {
+				log.Printf("Failed to publish finalized pool %s: %v", pool.Pair, err)
+			}
+		}
+		finalized.Mu.RUnlock()
+	}
+}
+
+// decodedSwap is a swap decoded from log, emitted by pool. Its row is built
+// once the graph is unlocked, since valuing it can query the tokens table.
+type decodedSwap struct {
+	pool *graph.Pool
+	log  types.Log
+	swap dexes.Swap
+}
+
+// newSwap builds the row of a swap decoded from vLog, emitted by pool.
+func newSwap(pool *graph.Pool, vLog types.Log, swap dexes.Swap) *models.Swap {
+	row := volume.NewSwap(pool.Chain, pool.Pair, pool.Dex, pool.Token0, pool.Token1, swap.Amount0, swap.Amount1)
+	row.BlockNumber = int64(vLog.BlockNumber)
+	row.TxHash = vLog.TxHash.Hex()
+	row.LogIndex = int(vLog.Index)
+	return row
+}
+
+// record builds the rows of the decoded swaps, dates them, the price ticks of
+// samples and history rows with the timestamp of their block and stores them
+// in one transaction. Failures are logged rather than returned so a database
+// outage does not stall the graph, and ok reports whether everything was
+// stored.
+func (h *ChainHandler) record(ctx context.Context, db *pop.Connection, decoded []decodedSwap, samples []*graph.PriceSample, rows []*models.PoolHistory) (ok bool) {
+	if len(decoded) == 0 && len(samples) == 0 && len(rows) == 0 {
+		return true
+	}
+
+	swaps := make([]*models.Swap, 0, len(decoded))
+	for _, d := range decoded {
+		swap := newSwap(d.pool, d.log, d.swap)
+		swap.TradedAt = h.blockTime(ctx, swap.BlockNumber)
+		swaps = append(swaps, swap)
+	}
+	ticks := make([]*models.PriceTick, 0, len(samples))
+	for _, sample := range samples {
+		if tick, ok := edges.PriceTick(sample, h.blockTime(ctx, int64(sample.Log.BlockNumber))); ok {
+			ticks = append(ticks, tick)
+		}
+	}
+	// Blocks in order make the most of the cached block time.
+	sort.Slice(rows, func(i, j int) bool { return rows[i].BlockNumber < rows[j].BlockNumber })
+	for _, row := range rows {
+		row.BlockTime = h.blockTime(ctx, row.BlockNumber)
+	}
+
+	err := db.WithContext(ctx).Transaction(func(tx *pop.Connection) error {
+		for _, swap := range swaps {
+			if err := volume.Record(tx, swap); err != nil {
+				return err
+			}
+		}
+		for _, tick := range ticks {
+			if err := edges.RecordPriceTick(tx, tick); err != nil {
+				return err
+			}
+		}
+		return history.Record(tx, rows)
+	})
+	if err != nil {
+		log.Printf("Failed to record %s swaps, price ticks and pool history: %v", h.GetChainName(), err)
+		return false
+	}
+	return true
+}
+
+// exportStates returns the history rows of the pools in touched at the last
+// block that changed them and, when checkpoint is set, of every pool of the
+// chain at newestBlock. The caller must hold at least a read lock on g.
+func (h *ChainHandler) exportStates(g *graph.Graph, touched map[string]*graph.Pool, lastBlock map[string]int64, newestBlock int64, checkpoint bool) []*models.PoolHistory {
+	var rows []*models.PoolHistory
+	for _, pool := range g.Pools {
+		_, changed := touched[pool.Pair]
+		if pool.Chain != h.Chain || (!changed && !checkpoint) {
+			continue
+		}
+		adapter := dexes.AdapterFor(pool)
+		if adapter == nil {
+			continue
+		}
+		state, err := adapter.ExportState(g, pool)
+		if err != nil {
+			log.Printf("Failed to export pool %s for history: %v", pool.Pair, err)
+			continue
+		}
+		block := newestBlock
+		if changed {
+			block = lastBlock[pool.Pair]
+		}
+		rows = append(rows, newPoolHistory(pool, block, state, checkpoint && block == newestBlock))
+		if checkpoint && block != newestBlock {
+			rows = append(rows, newPoolHistory(pool, newestBlock, state, true))
+		}
+	}
+	return rows
+}
+
+// newPoolHistory builds the history row of pool holding state once block
+// was applied.
+func newPoolHistory(pool *graph.Pool, block int64, state []byte, checkpoint bool) *models.PoolHistory {
+	return &models.PoolHistory{
+		Chain:       pool.Chain,
+		Pool:        pool.Pair,
+		Dex:         pool.Dex,
+		Token0:      pool.Token0,
+		Token1:      pool.Token1,
+		Factory:     pool.Factory,
+		BlockNumber: block,
+		State:       state,
+		Checkpoint:  checkpoint,
+	}
+}
+
+// blockTime returns the timestamp of block, or the current time when the
+// node cannot be reached.
+func (h *ChainHandler) blockTime(ctx context.Context, block int64) time.Time {
+	if h.lastBlockTime.Number == block && !h.lastBlockTime.Time.IsZero() {
+		return h.lastBlockTime.Time
+	}
+
+	ref, err := h.BlockRef(ctx, block)
+	if err != nil {
+		log.Printf("Failed to get the timestamp of %s block %d: %v", h.GetChainName(), block, err)
+		return time.Now().UTC()
+	}
+	h.lastBlockTime = ref
+	return ref.Time
+}
+
+// importState replaces the edges of pool in g with the ones rebuilt from
+// state. The caller must hold the write lock on g.
+func importState(g *graph.Graph, pool *graph.Pool, state []byte) error {
+	adapter := dexes.AdapterFor(pool)
+	if adapter == nil {
+		return fmt.Errorf("no adapter registered for pool %s (%s)", pool.Pair, pool.Dex)
+	}
+
+	edge01, edge10, err := adapter.ImportState(pool, state)
+	if err != nil {
+		return err
+	}
+	if edge01 != nil {
+		g.NewEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain, edge01)
+	}
+	if edge10 != nil {
+		g.NewEdge(pool.Token1, pool.Token0, pool.Pair, pool.Chain, edge10)
+	}
+	return nil
+}
+
+func hasTopic(topics []common.Hash, topic common.Hash) bool {
+	for _, t := range topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *ChainHandler) GetChainName() string {
+	return h.Name
+}
+
+func (h *ChainHandler) GetBlockTime() time.Duration {
+	return h.BlockTime
+}
+
+func (h *ChainHandler) GetConfirmations() int64 {
+	return h.Confirmations
+}
+
+func (h *ChainHandler) GetChainID() string {
+	return h.ChainID
+}
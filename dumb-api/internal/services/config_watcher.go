@@ -0,0 +1,441 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"dumb-api/config"
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/graph/edges"
+	"dumb-api/internal/rpcpool"
+	"dumb-api/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce groups the burst of write events editors emit on save.
+const reloadDebounce = 500 * time.Millisecond
+
+var configWatcher *ConfigWatcher
+
+// ConfigWatcher reloads evm_config.json at runtime and reconciles the graph
+// with the new token and factory lists.
+type ConfigWatcher struct {
+	Path    string
+	Graph   *graph.Graph
+	Clients *rpcpool.Registry
+
+	mu sync.Mutex
+}
+
+// ReloadSummary describes what changed in the graph after a reload.
+type ReloadSummary struct {
+	AddedTokens   []string `json:"addedTokens"`
+	RemovedTokens []string `json:"removedTokens"`
+	AddedPools    []string `json:"addedPools"`
+	RetiredPools  []string `json:"retiredPools"`
+}
+
+// InitConfigWatcher creates the process wide config watcher. Chains added by a
+// reload get their RPC provider pool registered in clients.
+func InitConfigWatcher(path string, g *graph.Graph, clients *rpcpool.Registry) *ConfigWatcher {
+	if configWatcher == nil {
+		configWatcher = &ConfigWatcher{
+			Path:    path,
+			Graph:   g,
+			Clients: clients,
+		}
+	}
+	return configWatcher
+}
+
+// GetConfigWatcher returns the process wide config watcher, or nil if it was
+// never initialized.
+func GetConfigWatcher() *ConfigWatcher {
+	return configWatcher
+}
+
+// Watch reloads the config whenever the file changes or SIGHUP is received.
+// It blocks until ctx is cancelled.
+func (w *ConfigWatcher) Watch(ctx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Failed to create config file watcher, only SIGHUP reloads are available: %v", err)
+	} else {
+		defer watcher.Close()
+		// Watch the directory rather than the file so that editors and
+		// ConfigMap updates that replace the file are picked up too.
+		if err := watcher.Add(filepath.Dir(w.Path)); err != nil {
+			log.Printf("Failed to watch %s: %v", w.Path, err)
+		}
+	}
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if watcher != nil {
+		events = watcher.Events
+		errs = watcher.Errors
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-events:
+			if filepath.Base(event.Name) != filepath.Base(w.Path) {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			debounce = time.After(reloadDebounce)
+		case err := <-errs:
+			log.Printf("Config file watcher error: %v", err)
+		case <-debounce:
+			debounce = nil
+			w.reloadAndLog(ctx, "file change")
+		case <-hup:
+			w.reloadAndLog(ctx, "SIGHUP")
+		}
+	}
+}
+
+func (w *ConfigWatcher) reloadAndLog(ctx context.Context, reason string) {
+	log.Printf("Reloading %s (%s)", w.Path, reason)
+	summary, err := w.Reload(ctx)
+	if err != nil {
+		log.Printf("Failed to reload %s: %v", w.Path, err)
+		return
+	}
+	log.Printf("Reloaded %s: +%d/-%d tokens, +%d/-%d pools", w.Path,
+		len(summary.AddedTokens), len(summary.RemovedTokens), len(summary.AddedPools), len(summary.RetiredPools))
+}
+
+// Reload reads the config file, discovers pools for added tokens, factories
+// and fee tiers, retires pools of removed ones and swaps the new config in.
+// Listeners of removed chains are stopped.
+// Pool discovery happens before the graph lock is taken so quotes keep being
+// served while new pools are fetched. When ctx is cancelled during discovery
+// the reload is abandoned and neither the graph nor the config change. A
+// chain whose new pools cannot be discovered for lack of an RPC provider
+// keeps its old config, so a later reload reconciles it.
+func (w *ConfigWatcher) Reload(ctx context.Context) (*ReloadSummary, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	newConfig, err := config.ReadEVMConfig(w.Path)
+	if err != nil {
+		return nil, err
+	}
+	oldConfig := config.GetEVMConfig()
+
+	summary := &ReloadSummary{}
+	staged := graph.NewGraph()
+	retired := make(map[string]bool)
+	var skipped []string
+
+	for chainName, newChain := range newConfig {
+		chain := strings.ToLower(chainName)
+		oldChain := oldConfig[chainName]
+
+		oldTokens := addressSet(tokenAddresses(oldChain.Tokens))
+		newTokens := addressSet(tokenAddresses(newChain.Tokens))
+		oldFactories := addressSet(dexFactories(oldChain))
+		newFactories := addressSet(dexFactories(newChain))
+
+		addedTokens := difference(newTokens, oldTokens)
+		removedTokens := difference(oldTokens, newTokens)
+		addedFactories := difference(newFactories, oldFactories)
+		removedFactories := difference(oldFactories, newFactories)
+		addedTiers, removedTiers := feeTierChanges(oldChain, newChain)
+
+		if len(addedTokens) > 0 || len(addedFactories) > 0 || len(addedTiers) > 0 {
+			client, err := w.client(ctx, chainName, newChain)
+			if err != nil {
+				// The chain keeps its old config so the next reload
+				// discovers the pools of its additions.
+				log.Printf("Skipping %s changes: %v", chainName, err)
+				skipped = append(skipped, chainName)
+				continue
+			}
+
+			include := func(factory, tokenA, tokenB common.Address) bool {
+				return addedFactories[factory] || addedTokens[tokenA] || addedTokens[tokenB]
+			}
+
+			for _, dexConfig := range newChain.DexConfigs() {
+				// Pools of added fee tiers are looked up for every pair by
+				// an adapter restricted to those tiers. It is registered
+				// first so the adapter with every tier replaces it.
+				if tiers := addedTiers[dexes.ID(dexConfig)]; len(tiers) > 0 {
+					tierConfig := dexConfig
+					tierConfig.FeeTiers = tiers
+					if adapter, err := dexes.NewAdapter(chain, tierConfig, client); err == nil {
+						staged.Merge(dexes.Bootstrap(ctx, adapter, tokenAddresses(newChain.Tokens), nil))
+					}
+				}
+
+				adapter, err := dexes.NewAdapter(chain, dexConfig, client)
+				if err != nil {
+					log.Printf("Skipping %s DEX on %s: %v", dexConfig.Type, chainName, err)
+					continue
+				}
+				staged.Merge(dexes.Bootstrap(ctx, adapter, tokenAddresses(newChain.Tokens), include))
+			}
+		}
+
+		for token := range addedTokens {
+			summary.AddedTokens = append(summary.AddedTokens, token.String())
+		}
+		for token := range removedTokens {
+			summary.RemovedTokens = append(summary.RemovedTokens, token.String())
+		}
+
+		w.Graph.Mu.RLock()
+		for addr, pool := range w.Graph.Pools {
+			if pool.Chain != chain {
+				continue
+			}
+			if removedTokens[common.HexToAddress(pool.Token0)] ||
+				removedTokens[common.HexToAddress(pool.Token1)] ||
+				removedFactories[common.HexToAddress(pool.Factory)] ||
+				inFeeTiers(w.Graph, pool, removedTiers[pool.DexID]) {
+				retired[addr] = true
+			}
+		}
+		w.Graph.Mu.RUnlock()
+	}
+
+	for _, chainName := range skipped {
+		if oldChain, ok := oldConfig[chainName]; ok {
+			newConfig[chainName] = oldChain
+		} else {
+			delete(newConfig, chainName)
+		}
+	}
+
+	for chainName, oldChain := range oldConfig {
+		if _, ok := newConfig[chainName]; ok {
+			continue
+		}
+		for token := range addressSet(tokenAddresses(oldChain.Tokens)) {
+			summary.RemovedTokens = append(summary.RemovedTokens, token.String())
+		}
+		chain := strings.ToLower(chainName)
+		w.Graph.Mu.RLock()
+		for addr, pool := range w.Graph.Pools {
+			if pool.Chain == chain {
+				retired[addr] = true
+			}
+		}
+		w.Graph.Mu.RUnlock()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var removedChains []string
+	for chainName := range oldConfig {
+		if _, ok := newConfig[chainName]; !ok {
+			removedChains = append(removedChains, chainName)
+		}
+	}
+
+	if finalized := graph.GetFinalizedGraph(); finalized != nil {
+		finalized.Mu.Lock()
+		finalized.Merge(staged.Clone())
+		for addr := range retired {
+			finalized.DeletePool(addr)
+		}
+		finalized.Mu.Unlock()
+	}
+
+	w.Graph.Mu.Lock()
+	for addr := range staged.Pools {
+		if !w.Graph.HasPool(addr) {
+			summary.AddedPools = append(summary.AddedPools, addr)
+		}
+	}
+	w.Graph.Merge(staged)
+	for addr := range retired {
+		w.Graph.DeletePool(addr)
+		summary.RetiredPools = append(summary.RetiredPools, addr)
+	}
+	// Token home/remote mappings are read from the config on every quote, so
+	// swapping it under the graph lock keeps both views consistent. Bridge
+	// edges connect the tokens of the config and are rebuilt with it.
+	config.SetEVMConfig(newConfig)
+	edges.RemoveBridges(w.Graph)
+	edges.AddBridges(w.Graph)
+	w.Graph.Mu.Unlock()
+
+	if finalized := graph.GetFinalizedGraph(); finalized != nil {
+		finalized.Mu.Lock()
+		edges.RemoveBridges(finalized)
+		edges.AddBridges(finalized)
+		finalized.Mu.Unlock()
+	}
+
+	// Chains added by the reload need a listener to keep their pools up to
+	// date, and those removed no longer have pools to listen to.
+	if supervisor := GetSupervisor(); supervisor != nil {
+		for _, chainName := range removedChains {
+			supervisor.Stop(chainName)
+		}
+		for chainName := range newConfig {
+			supervisor.Ensure(chainName)
+		}
+	}
+
+	for addr, pool := range staged.Pools {
+		if err := setPoolStatus(pool.Chain, addr, "active"); err != nil {
+			log.Printf("Failed to activate pool %s: %v", addr, err)
+		}
+	}
+	for addr := range retired {
+		if err := setPoolStatus("", addr, "retired"); err != nil {
+			log.Printf("Failed to retire pool %s: %v", addr, err)
+		}
+	}
+
+	return summary, nil
+}
+
+// client returns the RPC provider pool of chainName, connecting to it when the
+// chain was added by the reload.
+func (w *ConfigWatcher) client(ctx context.Context, chainName string, chainConfig config.ChainConfig) (*rpcpool.Pool, error) {
+	if client, ok := w.Clients.Get(chainName); ok {
+		return client, nil
+	}
+	rpcURLs := config.RPCURLs(chainName, chainConfig)
+	if len(rpcURLs) == 0 {
+		return nil, fmt.Errorf("no RPC URL configured for %s", chainName)
+	}
+	client, err := rpcpool.Dial(ctx, chainName, rpcURLs, chainConfig.RpcQuorum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s network: %w", chainName, err)
+	}
+	w.Clients.Set(chainName, client)
+	return client, nil
+}
+
+func setPoolStatus(chain, pair, status string) error {
+	query := "UPDATE pool_states SET status = ?, updated_at = ? WHERE pair = ?"
+	args := []interface{}{status, time.Now(), pair}
+	if chain != "" {
+		query += " AND chain_id = ?"
+		args = append(args, chain)
+	}
+	if err := models.DB.RawQuery(query, args...).Exec(); err != nil {
+		return fmt.Errorf("failed to update pool status: %w", err)
+	}
+	return nil
+}
+
+// feeTierChanges returns the fee tiers added to and removed from each DEX of
+// oldChain that newChain keeps, keyed by DEX id. DEXes without fee tiers of
+// their own use the FEE_TIERS default.
+func feeTierChanges(oldChain, newChain config.ChainConfig) (map[string][]string, map[string][]string) {
+	oldTiers := make(map[string][]string)
+	for _, dexConfig := range oldChain.DexConfigs() {
+		oldTiers[dexes.ID(dexConfig)] = feeTiers(dexConfig)
+	}
+
+	added := make(map[string][]string)
+	removed := make(map[string][]string)
+	for _, dexConfig := range newChain.DexConfigs() {
+		id := dexes.ID(dexConfig)
+		old, ok := oldTiers[id]
+		if !ok {
+			continue
+		}
+		tiers := feeTiers(dexConfig)
+		for _, tier := range tiers {
+			if !slices.Contains(old, tier) {
+				added[id] = append(added[id], tier)
+			}
+		}
+		for _, tier := range old {
+			if !slices.Contains(tiers, tier) {
+				removed[id] = append(removed[id], tier)
+			}
+		}
+	}
+	return added, removed
+}
+
+func feeTiers(dexConfig config.DexConfig) []string {
+	if len(dexConfig.FeeTiers) > 0 {
+		return dexConfig.FeeTiers
+	}
+	return config.FeeTiers
+}
+
+// inFeeTiers reports whether the fee of pool is one of tiers. The caller must
+// hold a read lock on g.
+func inFeeTiers(g *graph.Graph, pool *graph.Pool, tiers []string) bool {
+	if len(tiers) == 0 {
+		return false
+	}
+	inspector, ok := dexes.AdapterFor(pool).(dexes.Inspector)
+	if !ok {
+		return false
+	}
+	info, ok := inspector.Inspect(g, pool)
+	if !ok {
+		return false
+	}
+	return slices.Contains(tiers, strconv.FormatUint(uint64(info.Fee), 10))
+}
+
+func tokenAddresses(tokens []config.TokenConfig) []string {
+	addresses := make([]string, len(tokens))
+	for i, token := range tokens {
+		addresses[i] = token.Address
+	}
+	return addresses
+}
+
+func dexFactories(chainConfig config.ChainConfig) []string {
+	var factories []string
+	for _, dexConfig := range chainConfig.DexConfigs() {
+		factories = append(factories, dexConfig.Factories...)
+	}
+	return factories
+}
+
+func addressSet(addresses []string) map[common.Address]bool {
+	set := make(map[common.Address]bool, len(addresses))
+	for _, addr := range addresses {
+		set[common.HexToAddress(addr)] = true
+	}
+	return set
+}
+
+func difference(a, b map[common.Address]bool) map[common.Address]bool {
+	diff := make(map[common.Address]bool)
+	for addr := range a {
+		if !b[addr] {
+			diff[addr] = true
+		}
+	}
+	return diff
+}
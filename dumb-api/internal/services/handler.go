@@ -2,17 +2,76 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"time"
 
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/gobuffalo/pop/v6"
 )
 
+// ReorgWindow is how many blocks behind the last ingested one the listener
+// keeps hashes and state journals for. Reorgs deeper than this resync the
+// affected chain from the current on-chain state instead.
+const ReorgWindow int64 = 128
+
+// EVMHandler ingests the logs of one chain. Every method honours ctx, so a
+// cancelled listener stops at the next RPC or database call.
 type EVMHandler interface {
-	UpdateLastBlock(db *pop.Connection, block int64) error
-	LastBlock(ctx context.Context, db *pop.Connection) (int64, error)
+	UpdateLastBlock(ctx context.Context, db *pop.Connection, block BlockRef) error
+	LastBlock(ctx context.Context, db *pop.Connection) (BlockRef, error)
 	Block(ctx context.Context, height *int64) (*types.Block, error)
-	BlockResult(ctx context.Context, height *int64) (*types.Block, error)
-	Listen(db *pop.Connection, block *types.Block) error
+	BlockRef(ctx context.Context, number int64) (BlockRef, error)
+	BlockNumber(ctx context.Context) (int64, error)
+	Logs(ctx context.Context, from, to int64) ([]types.Log, error)
+	Listen(ctx context.Context, db *pop.Connection, logs []types.Log) error
+	// Rollback restores the pools of the chain to their state at block,
+	// undoing every log applied for later blocks.
+	Rollback(ctx context.Context, db *pop.Connection, block int64) error
+	// Finalize applies to the finalized graph every block up to block.
+	Finalize(ctx context.Context, db *pop.Connection, block int64) error
 	GetChainName() string
 	GetChainID() string
+	GetBlockTime() time.Duration
+	GetConfirmations() int64
+}
+
+// LogSubscriber is implemented by handlers able to stream heads and logs
+// instead of being polled.
+type LogSubscriber interface {
+	CanSubscribe() bool
+	Subscribe(ctx context.Context, heads chan<- BlockRef, logs chan<- types.Log) (ethereum.Subscription, error)
+}
+
+// BlockRef identifies a block by number and hash, along with its timestamp.
+// Hashes are taken from the
+// node rather than computed from decoded headers, since chains such as
+// Avalanche add header fields go-ethereum does not hash.
+type BlockRef struct {
+	Number     int64
+	Hash       common.Hash
+	ParentHash common.Hash
+	Time       time.Time
+}
+
+func (b *BlockRef) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Number     hexutil.Uint64 `json:"number"`
+		Hash       common.Hash    `json:"hash"`
+		ParentHash common.Hash    `json:"parentHash"`
+		Timestamp  hexutil.Uint64 `json:"timestamp"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	b.Number = int64(raw.Number)
+	b.Hash = raw.Hash
+	b.ParentHash = raw.ParentHash
+	b.Time = time.Unix(int64(raw.Timestamp), 0).UTC()
+	return nil
 }
+
+var errTrackedPoolsChanged = errors.New("tracked pools changed")
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/pricing"
+	"dumb-api/internal/streams"
+	"dumb-api/models"
+
+	"github.com/gobuffalo/pop/v6"
+	"github.com/lib/pq"
+)
+
+// PoolUpdatesChannel is the Postgres channel through which a listener deployed
+// on its own feeds the graphs of one or more API replicas. It works as follows:
+//
+//   - After applying a block, the listener exports the state of every pool the
+//     block touched through the pool's DexAdapter and inserts one row per pool
+//     into pool_updates.
+//   - The same statement issues NOTIFY pool_updates with the row id as payload.
+//     State is not sent in the payload itself because V3 tick lists can exceed
+//     the 8000 byte NOTIFY limit.
+//   - Subscribers LISTEN on pool_updates and, on every notification or
+//     reconnect, read all rows with an id greater than the last one applied
+//     and import them through the owning adapter. Rows are applied in id
+//     order, so a replica that misses notifications still converges.
+//   - Listeners of several chains publish concurrently, so a row can commit
+//     after rows with greater ids were read. Subscribers keep reading the
+//     ids they skipped for PoolUpdateGapTimeout, which outlasts any publish
+//     transaction; ids still missing then belong to rolled back inserts.
+//   - Rows flagged finalized carry the state of the pool in the finalized view
+//     and are imported into the finalized graph instead of the latest one.
+//   - The publisher deletes rows older than PoolUpdateRetention.
+const PoolUpdatesChannel = "pool_updates"
+
+// PoolUpdateRetention is how long published updates stay available to
+// subscribers catching up after a disconnect.
+const PoolUpdateRetention = time.Hour
+
+// PoolUpdateGapTimeout is how long subscribers wait for a skipped id to
+// commit.
+const PoolUpdateGapTimeout = time.Minute
+
+// maxPoolUpdateGaps bounds the skipped ids a subscriber tracks.
+const maxPoolUpdateGaps = 10000
+
+// PoolUpdatePublisher writes pool state changes to the pool_updates channel.
+// The listeners of every chain share it.
+type PoolUpdatePublisher struct {
+	db *pop.Connection
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+func NewPoolUpdatePublisher(db *pop.Connection) *PoolUpdatePublisher {
+	return &PoolUpdatePublisher{db: db}
+}
+
+// Publish exports the state of pool from g and notifies subscribers. The
+// caller must hold at least a read lock on g, which is the finalized graph
+// when finalized is set.
+func (p *PoolUpdatePublisher) Publish(ctx context.Context, g *graph.Graph, pool *graph.Pool, blockNumber int64, finalized bool) error {
+	adapter := dexes.AdapterFor(pool)
+	if adapter == nil {
+		return fmt.Errorf("no adapter registered for pool %s (%s)", pool.Pair, pool.Dex)
+	}
+
+	state, err := adapter.ExportState(g, pool)
+	if err != nil {
+		return fmt.Errorf("failed to export pool %s: %w", pool.Pair, err)
+	}
+
+	db := p.db.WithContext(ctx)
+	err = db.RawQuery(
+		`WITH inserted AS (
+			INSERT INTO pool_updates (chain, pool, dex, block_number, state, finalized, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			RETURNING id
+		)
+		SELECT pg_notify(?, id::text) FROM inserted`,
+		pool.Chain, pool.Pair, pool.Dex, blockNumber, state, finalized, time.Now(), PoolUpdatesChannel,
+	).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to publish pool %s: %w", pool.Pair, err)
+	}
+
+	if p.shouldPrune() {
+		err = db.RawQuery("DELETE FROM pool_updates WHERE created_at < ?", time.Now().Add(-PoolUpdateRetention)).Exec()
+		if err != nil {
+			log.Printf("Failed to prune pool updates: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// PoolUpdateCursor returns the id of the last published pool update. Replicas
+// read it before bootstrapping their graph and subscribe from it, so updates
+// published while the graph loads are applied too.
+func PoolUpdateCursor(ctx context.Context, db *pop.Connection) (int64, error) {
+	var last struct {
+		ID int64 `db:"id"`
+	}
+	if err := db.WithContext(ctx).RawQuery("SELECT COALESCE(MAX(id), 0) AS id FROM pool_updates").First(&last); err != nil {
+		return 0, fmt.Errorf("failed to read last pool update: %w", err)
+	}
+	return last.ID, nil
+}
+
+// shouldPrune reports whether old updates are due for deletion, in which
+// case the caller deletes them.
+func (p *PoolUpdatePublisher) shouldPrune() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.lastPruned) <= PoolUpdateRetention/4 {
+		return false
+	}
+	p.lastPruned = time.Now()
+	return true
+}
+
+// SubscribePoolUpdates applies the pool updates published after the one with
+// id lastID to g, or to the finalized graph for finalized updates. Failing to
+// listen is retried with the same backoff as failed chain listeners. It
+// blocks until ctx is cancelled and is meant to run in its own goroutine.
+func SubscribePoolUpdates(ctx context.Context, db *pop.Connection, g *graph.Graph, lastID int64) {
+	listener := pq.NewListener(db.URL(), time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Pool update listener event %d: %v", event, err)
+		}
+	})
+	defer listener.Close()
+
+	delay := minRestartDelay
+	for {
+		err := listener.Listen(PoolUpdatesChannel)
+		if err == nil || errors.Is(err, pq.ErrChannelAlreadyOpen) {
+			break
+		}
+		log.Printf("Failed to listen on %s, retrying in %s: %v", PoolUpdatesChannel, delay, err)
+		sleep(ctx, delay)
+		if ctx.Err() != nil {
+			return
+		}
+		delay = min(delay*2, maxRestartDelay)
+	}
+
+	db = db.WithContext(ctx)
+	cursor := newUpdateCursor(lastID)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-listener.Notify:
+			// A nil notification signals a reconnect, both cases catch up
+			// from the last applied id.
+		case <-time.After(time.Minute):
+			if err := listener.Ping(); err != nil {
+				log.Printf("Pool update listener ping failed: %v", err)
+			}
+		}
+
+		var updates models.PoolUpdates
+		query, args := cursor.query()
+		err := db.Where(query, args...).Order("id asc").All(&updates)
+		if err != nil {
+			log.Printf("Failed to read pool updates: %v", err)
+			continue
+		}
+
+		for _, update := range updates {
+			cursor.advance(update.ID, time.Now())
+			target := g
+			if update.Finalized {
+				target = graph.GetFinalizedGraph()
+			}
+			pool, err := applyPoolUpdate(target, update)
+			if err != nil {
+				log.Printf("Failed to apply pool update %d: %v", update.ID, err)
+			} else if !update.Finalized {
+				pricing.Touch(pool)
+				streams.Notify(pool.Chain, update.BlockNumber, pool)
+			}
+		}
+		cursor.expire(time.Now())
+	}
+}
+
+// updateCursor tracks the pool updates a subscriber applied: every id up to
+// last, except the gaps skipped while reading ids after them, which are
+// mapped to when they were skipped.
+type updateCursor struct {
+	last int64
+	gaps map[int64]time.Time
+}
+
+func newUpdateCursor(last int64) *updateCursor {
+	return &updateCursor{last: last, gaps: make(map[int64]time.Time)}
+}
+
+// query returns the condition selecting the updates not applied yet.
+func (c *updateCursor) query() (string, []interface{}) {
+	if len(c.gaps) == 0 {
+		return "id > ?", []interface{}{c.last}
+	}
+	args := []interface{}{c.last}
+	placeholders := make([]string, 0, len(c.gaps))
+	for id := range c.gaps {
+		args = append(args, id)
+		placeholders = append(placeholders, "?")
+	}
+	return "id > ? OR id IN (" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// advance records the update with id as applied at now, leaving the ids
+// skipped to reach it as gaps.
+func (c *updateCursor) advance(id int64, now time.Time) {
+	if id <= c.last {
+		delete(c.gaps, id)
+		return
+	}
+	for gap := c.last + 1; gap < id && len(c.gaps) < maxPoolUpdateGaps; gap++ {
+		c.gaps[gap] = now
+	}
+	c.last = id
+}
+
+// expire stops waiting for the gaps skipped PoolUpdateGapTimeout before now.
+func (c *updateCursor) expire(now time.Time) {
+	for id, skipped := range c.gaps {
+		if now.Sub(skipped) >= PoolUpdateGapTimeout {
+			delete(c.gaps, id)
+		}
+	}
+}
+
+// applyPoolUpdate imports the state of update into g and returns the pool it
+// updated.
+func applyPoolUpdate(g *graph.Graph, update models.PoolUpdate) (*graph.Pool, error) {
+	g.Mu.RLock()
+	pool := g.GetPool(update.Pool)
+	g.Mu.RUnlock()
+
+	if pool == nil {
+		return nil, fmt.Errorf("pool %s is not tracked", update.Pool)
+	}
+
+	adapter := dexes.AdapterFor(pool)
+	if adapter == nil {
+		return nil, fmt.Errorf("no adapter registered for pool %s (%s)", pool.Pair, pool.Dex)
+	}
+
+	edge01, edge10, err := adapter.ImportState(pool, update.State)
+	if err != nil {
+		return nil, err
+	}
+
+	g.Mu.Lock()
+	if edge01 != nil {
+		g.NewEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain, edge01)
+	}
+	if edge10 != nil {
+		g.NewEdge(pool.Token1, pool.Token0, pool.Pair, pool.Chain, edge10)
+	}
+	g.Mu.Unlock()
+
+	return pool, nil
+}
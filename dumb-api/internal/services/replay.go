@@ -0,0 +1,331 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+
+	"dumb-api/config"
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/rpcpool"
+	"dumb-api/models"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ReplaySnapshot is the state of a set of pools after a block. Replays write
+// one per block and accept one as their starting point, so any block of a
+// previous replay can be replayed again from.
+type ReplaySnapshot struct {
+	Chain string       `json:"chain"`
+	Block int64        `json:"block"`
+	Pools []ReplayPool `json:"pools"`
+	Quote *ReplayQuote `json:"quote,omitempty"`
+	// Transactions are the hashes of the transactions whose logs the block
+	// applied.
+	Transactions []common.Hash `json:"transactions,omitempty"`
+}
+
+// ReplayPool is a pool and its state as exported by its DexAdapter.
+type ReplayPool struct {
+	Pair    string          `json:"pair"`
+	Token0  string          `json:"token0"`
+	Token1  string          `json:"token1"`
+	Factory string          `json:"factory"`
+	Dex     string          `json:"dex"`
+	State   json.RawMessage `json:"state"`
+}
+
+// ReplayQuote is the best path found for a quote against the replayed pools.
+type ReplayQuote struct {
+	TokenIn   string       `json:"tokenIn"`
+	TokenOut  string       `json:"tokenOut"`
+	AmountIn  string       `json:"amountIn"`
+	AmountOut string       `json:"amountOut,omitempty"`
+	Path      []graph.Path `json:"path"`
+}
+
+// ReplayOptions selects what Replay reproduces.
+type ReplayOptions struct {
+	// Chain is the name of the chain in evm_config.json.
+	Chain string
+	// Pools are the pool addresses to replay. When starting from a snapshot
+	// they default to all of its pools.
+	Pools []string
+	// From is the block whose state the replay starts from, ignored when
+	// Snapshot is set.
+	From int64
+	// To is the last block replayed.
+	To int64
+	// Snapshot, when set, provides the starting state instead of the chain.
+	Snapshot *ReplaySnapshot
+	// TokenIn, TokenOut and AmountIn, when set, are quoted after every block.
+	TokenIn  string
+	TokenOut string
+	AmountIn *big.Int
+}
+
+// Replay rebuilds the state of the selected pools at the starting block,
+// either from a snapshot or from on-chain state read at that block, then
+// applies the logs of every following block up to opts.To through the same
+// adapters the listener uses. A snapshot of the starting block, of every
+// block that changed a replayed pool and of the last block is written to out
+// as one JSON document per line.
+//
+// Replays only touch their own graph and do not record price ticks.
+func Replay(ctx context.Context, opts ReplayOptions, out io.Writer) error {
+	chainName := strings.ToUpper(opts.Chain)
+	chainConfig, ok := config.GetChainConfig(chainName)
+	if !ok {
+		return fmt.Errorf("unknown chain %s", opts.Chain)
+	}
+	chain := strings.ToLower(chainName)
+
+	rpcURLs := config.RPCURLs(chainName, chainConfig)
+	if len(rpcURLs) == 0 {
+		return fmt.Errorf("no RPC URL configured for %s", chainName)
+	}
+	client, err := rpcpool.Dial(ctx, chainName, rpcURLs, chainConfig.RpcQuorum)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s network: %w", chainName, err)
+	}
+	defer client.Close()
+
+	for _, dexConfig := range chainConfig.DexConfigs() {
+		if _, err := dexes.NewAdapter(chain, dexConfig, client); err != nil {
+			return err
+		}
+	}
+
+	g := graph.NewGraph()
+	from := opts.From
+	if opts.Snapshot != nil {
+		from = opts.Snapshot.Block
+		err = loadSnapshot(g, chain, opts.Snapshot, opts.Pools)
+	} else {
+		err = loadPoolsAt(ctx, g, chainConfig, chain, opts.Pools, from)
+	}
+	if err != nil {
+		return err
+	}
+	if len(g.Pools) == 0 {
+		return fmt.Errorf("no pools to replay")
+	}
+	if opts.To < from {
+		return fmt.Errorf("block %d is before the starting block %d", opts.To, from)
+	}
+
+	enc := json.NewEncoder(out)
+	if err := enc.Encode(replaySnapshot(g, chain, from, nil, opts)); err != nil {
+		return err
+	}
+
+	query := ethereum.FilterQuery{}
+	var topics []common.Hash
+	for _, adapter := range dexes.ChainAdapters(chain) {
+		topics = append(topics, adapter.Topics()...)
+	}
+	query.Topics = [][]common.Hash{topics}
+	for pair := range g.Pools {
+		query.Addresses = append(query.Addresses, common.HexToAddress(pair))
+	}
+
+	last := from
+	for start := from + 1; start <= opts.To; start += maxLogRange {
+		end := min(start+maxLogRange-1, opts.To)
+		query.FromBlock = big.NewInt(start)
+		query.ToBlock = big.NewInt(end)
+
+		logs, err := client.FilterLogs(ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to get logs for blocks %d-%d: %w", start, end, err)
+		}
+		sort.Slice(logs, func(i, j int) bool {
+			if logs[i].BlockNumber != logs[j].BlockNumber {
+				return logs[i].BlockNumber < logs[j].BlockNumber
+			}
+			return logs[i].Index < logs[j].Index
+		})
+
+		for i := 0; i < len(logs); {
+			block := logs[i].BlockNumber
+			j := i
+			for j < len(logs) && logs[j].BlockNumber == block {
+				j++
+			}
+
+			applied := replayBlock(g, logs[i:j])
+			if err := enc.Encode(replaySnapshot(g, chain, int64(block), applied, opts)); err != nil {
+				return err
+			}
+			last = int64(block)
+			i = j
+		}
+	}
+
+	if last != opts.To {
+		return enc.Encode(replaySnapshot(g, chain, opts.To, nil, opts))
+	}
+	return nil
+}
+
+// replayBlock applies the logs of one block to g and returns the transaction
+// hashes of the logs that were applied. Their price samples are dropped so
+// reproducing past state does not record the prices again.
+func replayBlock(g *graph.Graph, logs []types.Log) []common.Hash {
+	var applied []common.Hash
+	for _, vLog := range logs {
+		if len(vLog.Topics) == 0 || vLog.Removed {
+			continue
+		}
+		pool := g.GetPool(vLog.Address.Hex())
+		if pool == nil {
+			continue
+		}
+		adapter := dexes.AdapterFor(pool)
+		if adapter == nil || !hasTopic(adapter.Topics(), vLog.Topics[0]) {
+			continue
+		}
+		adapter.ApplyLog(g, pool, vLog)
+		applied = append(applied, vLog.TxHash)
+	}
+	return applied
+}
+
+// loadSnapshot imports the state of the snapshot's pools, restricted to
+// pairs when it is not empty.
+func loadSnapshot(g *graph.Graph, chain string, snapshot *ReplaySnapshot, pairs []string) error {
+	selected := pairSet(pairs)
+	for _, p := range snapshot.Pools {
+		if len(selected) > 0 && !selected[strings.ToLower(p.Pair)] {
+			continue
+		}
+
+		pool := &graph.Pool{
+			Token0:  p.Token0,
+			Token1:  p.Token1,
+			Pair:    common.HexToAddress(p.Pair).Hex(),
+			Factory: p.Factory,
+			Chain:   chain,
+			Dex:     p.Dex,
+			DexID:   dexes.IDFor(chain, p.Dex, p.Factory),
+		}
+		g.AddPool(pool)
+		if err := importState(g, pool, p.State); err != nil {
+			return fmt.Errorf("failed to import pool %s: %w", p.Pair, err)
+		}
+	}
+	return nil
+}
+
+// loadPoolsAt builds the edges of pairs from their on-chain state at block.
+// Pools are looked up in pool_states, and their DEX is the one configured
+// with their factory.
+func loadPoolsAt(ctx context.Context, g *graph.Graph, chainConfig config.ChainConfig, chain string, pairs []string, block int64) error {
+	if len(pairs) == 0 {
+		return fmt.Errorf("no pools selected")
+	}
+
+	dexByFactory := make(map[common.Address]string)
+	for _, dexConfig := range chainConfig.DexConfigs() {
+		for _, factory := range dexConfig.Factories {
+			dexByFactory[common.HexToAddress(factory)] = dexConfig.Type
+		}
+	}
+
+	ctx = rpcpool.AtBlock(ctx, block)
+	for _, pair := range pairs {
+		var poolState models.PoolState
+		err := models.DB.WithContext(ctx).
+			Where("chain_id = ? AND LOWER(pair) = ?", chain, strings.ToLower(pair)).
+			First(&poolState)
+		if err != nil {
+			return fmt.Errorf("pool %s is not known on %s: %w", pair, chain, err)
+		}
+
+		dex, ok := dexByFactory[common.HexToAddress(poolState.Factory)]
+		if !ok {
+			return fmt.Errorf("factory %s of pool %s is not configured", poolState.Factory, pair)
+		}
+
+		pool := &graph.Pool{
+			Token0:  poolState.Token0,
+			Token1:  poolState.Token1,
+			Pair:    common.HexToAddress(poolState.Pair).Hex(),
+			Factory: poolState.Factory,
+			Chain:   chain,
+			Dex:     dex,
+			DexID:   dexes.IDFor(chain, dex, poolState.Factory),
+		}
+
+		edge01, edge10, err := dexes.AdapterFor(pool).BuildEdges(ctx, pool)
+		if err != nil {
+			return fmt.Errorf("failed to load pool %s at block %d: %w", pair, block, err)
+		}
+
+		g.AddPool(pool)
+		if edge01 != nil {
+			g.NewEdge(pool.Token0, pool.Token1, pool.Pair, pool.Chain, edge01)
+		}
+		if edge10 != nil {
+			g.NewEdge(pool.Token1, pool.Token0, pool.Pair, pool.Chain, edge10)
+		}
+	}
+	return nil
+}
+
+// replaySnapshot exports the state of every pool of g and, when requested,
+// quotes against it.
+func replaySnapshot(g *graph.Graph, chain string, block int64, transactions []common.Hash, opts ReplayOptions) ReplaySnapshot {
+	snapshot := ReplaySnapshot{Chain: chain, Block: block, Transactions: transactions}
+
+	for _, pool := range g.Pools {
+		entry := ReplayPool{
+			Pair:    pool.Pair,
+			Token0:  pool.Token0,
+			Token1:  pool.Token1,
+			Factory: pool.Factory,
+			Dex:     pool.Dex,
+		}
+		if adapter := dexes.AdapterFor(pool); adapter != nil {
+			if state, err := adapter.ExportState(g, pool); err == nil {
+				entry.State = state
+			}
+		}
+		snapshot.Pools = append(snapshot.Pools, entry)
+	}
+	sort.Slice(snapshot.Pools, func(i, j int) bool {
+		return snapshot.Pools[i].Pair < snapshot.Pools[j].Pair
+	})
+
+	if opts.AmountIn != nil && opts.TokenIn != "" && opts.TokenOut != "" {
+		paths := g.GetBestPaths(opts.TokenIn, opts.TokenOut, chain, opts.AmountIn, new(big.Float).SetFloat64(0.01))
+		quote := &ReplayQuote{
+			TokenIn:  opts.TokenIn,
+			TokenOut: opts.TokenOut,
+			AmountIn: opts.AmountIn.String(),
+			Path:     paths,
+		}
+		if len(paths) > 0 {
+			quote.AmountOut = paths[len(paths)-1].AmountOut.String()
+		}
+		snapshot.Quote = quote
+	}
+
+	return snapshot
+}
+
+func pairSet(pairs []string) map[string]bool {
+	set := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		set[strings.ToLower(pair)] = true
+	}
+	return set
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"sync"
+
+	"dumb-api/internal/graph"
+)
+
+// stateJournal records the state of pools before each block changed them, so
+// that blocks orphaned by a reorg can be undone. Entries are appended in the
+// order blocks are applied, which is ascending by block number.
+type stateJournal struct {
+	mu      sync.Mutex
+	entries []journalEntry
+}
+
+type journalEntry struct {
+	block int64
+	pool  *graph.Pool
+	state []byte
+}
+
+// record stores state as the state of pool before block was applied.
+func (j *stateJournal) record(block int64, pool *graph.Pool, state []byte) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, journalEntry{block: block, pool: pool, state: state})
+}
+
+// rewind removes and returns the entries recorded for blocks after block,
+// newest first. Importing them in that order leaves every pool in its state
+// as of block.
+func (j *stateJournal) rewind(block int64) []journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// Entries are kept in application order, so walking them backwards
+	// imports the earliest state of each pool last.
+	i := len(j.entries)
+	for i > 0 && j.entries[i-1].block > block {
+		i--
+	}
+	undone := make([]journalEntry, 0, len(j.entries)-i)
+	for k := len(j.entries) - 1; k >= i; k-- {
+		undone = append(undone, j.entries[k])
+	}
+	j.entries = j.entries[:i]
+
+	return undone
+}
+
+// prune drops the entries of blocks before block.
+func (j *stateJournal) prune(block int64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	i := 0
+	for i < len(j.entries) && j.entries[i].block < block {
+		i++
+	}
+	j.entries = j.entries[i:]
+}
+
+// changed returns the pools changed by blocks after from up to and including
+// to.
+func (j *stateJournal) changed(from, to int64) []*graph.Pool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var pools []*graph.Pool
+	for _, entry := range j.entries {
+		if entry.block <= from || entry.block > to || seen[entry.pool.Pair] {
+			continue
+		}
+		seen[entry.pool.Pair] = true
+		pools = append(pools, entry.pool)
+	}
+	return pools
+}
+
+// stateAfter returns the state of pool once block was applied, which is the
+// state recorded before the next block that changed it. ok is false when no
+// later block changed the pool, so its current state is the one after block.
+func (j *stateJournal) stateAfter(pair string, block int64) (state []byte, ok bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, entry := range j.entries {
+		if entry.block > block && entry.pool.Pair == pair {
+			return entry.state, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"dumb-api/internal/graph"
+)
+
+func TestStateJournalRewind(t *testing.T) {
+	a := &graph.Pool{Pair: "0xa"}
+	b := &graph.Pool{Pair: "0xb"}
+
+	// Pool a is changed by blocks 10, 11 and 13, pool b by blocks 11 and 12.
+	recorded := []journalEntry{
+		{block: 10, pool: a, state: []byte("a9")},
+		{block: 11, pool: a, state: []byte("a10")},
+		{block: 11, pool: b, state: []byte("b10")},
+		{block: 12, pool: b, state: []byte("b11")},
+		{block: 13, pool: a, state: []byte("a12")},
+	}
+
+	tests := []struct {
+		name   string
+		block  int64
+		undone []string
+		kept   int
+	}{
+		{"nothing after the last block", 13, []string{}, 5},
+		{"one block", 12, []string{"a12"}, 4},
+		{"several blocks newest first", 10, []string{"a12", "b11", "b10", "a10"}, 1},
+		{"every block", 9, []string{"a12", "b11", "b10", "a10", "a9"}, 0},
+		{"before every block", 0, []string{"a12", "b11", "b10", "a10", "a9"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &stateJournal{}
+			for _, entry := range recorded {
+				j.record(entry.block, entry.pool, entry.state)
+			}
+
+			states := []string{}
+			for _, entry := range j.rewind(tt.block) {
+				states = append(states, string(entry.state))
+			}
+			if !reflect.DeepEqual(states, tt.undone) {
+				t.Errorf("rewind(%d) undid %v, want %v", tt.block, states, tt.undone)
+			}
+			if len(j.entries) != tt.kept {
+				t.Errorf("rewind(%d) kept %d entries, want %d", tt.block, len(j.entries), tt.kept)
+			}
+		})
+	}
+}
+
+func TestStateJournalRewindLeavesEarliestStateLast(t *testing.T) {
+	a := &graph.Pool{Pair: "0xa"}
+
+	j := &stateJournal{}
+	j.record(5, a, []byte("a4"))
+	j.record(6, a, []byte("a5"))
+	j.record(7, a, []byte("a6"))
+
+	// Importing the undone entries in order must leave the pool as of
+	// block 4, the state recorded before block 5.
+	var state string
+	for _, entry := range j.rewind(4) {
+		state = string(entry.state)
+	}
+	if state != "a4" {
+		t.Errorf("pool left in state %q, want %q", state, "a4")
+	}
+}
+
+func TestStateJournalPrune(t *testing.T) {
+	a := &graph.Pool{Pair: "0xa"}
+
+	tests := []struct {
+		name  string
+		block int64
+		kept  []int64
+	}{
+		{"before every block", 5, []int64{5, 6, 7}},
+		{"some blocks", 7, []int64{7}},
+		{"every block", 8, []int64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := &stateJournal{}
+			for _, block := range []int64{5, 6, 7} {
+				j.record(block, a, nil)
+			}
+
+			j.prune(tt.block)
+
+			kept := []int64{}
+			for _, entry := range j.entries {
+				kept = append(kept, entry.block)
+			}
+			if !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("prune(%d) kept blocks %v, want %v", tt.block, kept, tt.kept)
+			}
+		})
+	}
+}
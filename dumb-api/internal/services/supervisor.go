@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"dumb-api/config"
+	"dumb-api/internal/rpcpool"
+
+	"github.com/gobuffalo/pop/v6"
+)
+
+const (
+	// minRestartDelay and maxRestartDelay bound the backoff between restarts
+	// of a failed listener. The delay doubles with every consecutive failure
+	// and resets once a listener ran for maxRestartDelay.
+	minRestartDelay = time.Second
+	maxRestartDelay = time.Minute
+
+	// ShutdownTimeout bounds how long processes wait for listeners to
+	// finish the block they are applying after a shutdown signal.
+	ShutdownTimeout = 30 * time.Second
+)
+
+var supervisor *Supervisor
+
+// Supervisor runs one block listener per configured chain, each with its own
+// chain_states checkpoint, and restarts listeners that fail or panic.
+type Supervisor struct {
+	db        *pop.Connection
+	clients   rpcpool.Lookup
+	publisher *PoolUpdatePublisher
+	running   sync.WaitGroup
+
+	mu       sync.RWMutex
+	ctx      context.Context
+	statuses map[string]*ChainStatus
+	// listeners holds how to stop the listener of each chain and a channel
+	// closed once it stopped.
+	listeners map[string]listener
+}
+
+type listener struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// ChainStatus reports the progress of the listener of one chain.
+type ChainStatus struct {
+	Chain     string    `json:"chain"`
+	ChainID   string    `json:"chainId"`
+	State     string    `json:"state"`
+	LastBlock int64     `json:"lastBlock"`
+	Finalized int64     `json:"finalized"`
+	Head      int64     `json:"head"`
+	Lag       int64     `json:"lag"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"lastError,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	mu sync.Mutex
+}
+
+// InitSupervisor creates the process wide supervisor, which finds the RPC
+// provider pool of each chain through clients. When publisher is set, every
+// listener publishes the pools it updates.
+func InitSupervisor(db *pop.Connection, clients rpcpool.Lookup, publisher *PoolUpdatePublisher) *Supervisor {
+	if supervisor == nil {
+		supervisor = &Supervisor{
+			db:        db,
+			clients:   clients,
+			publisher: publisher,
+			statuses:  make(map[string]*ChainStatus),
+			listeners: make(map[string]listener),
+		}
+	}
+	return supervisor
+}
+
+// GetSupervisor returns the process wide supervisor, or nil if listeners run
+// in another process.
+func GetSupervisor() *Supervisor {
+	return supervisor
+}
+
+// Start launches a listener for every chain with an RPC provider. Listeners
+// run until ctx is cancelled; Wait blocks until all of them stopped.
+func (s *Supervisor) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	for name := range config.GetEVMConfig() {
+		s.Ensure(name)
+	}
+}
+
+// Ensure launches the listener of the chain called name in evm_config.json
+// unless it already runs, so chains added by a config reload are listened
+// to as well. It does nothing before Start or when the chain has no RPC
+// provider.
+func (s *Supervisor) Ensure(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx := s.ctx
+	if ctx == nil || ctx.Err() != nil {
+		return
+	}
+	if _, running := s.statuses[name]; running {
+		return
+	}
+
+	chainConfig, ok := config.GetChainConfig(name)
+	if !ok {
+		return
+	}
+	client, ok := s.clients(name)
+	if !ok {
+		log.Printf("No RPC provider for %s, not listening", name)
+		return
+	}
+
+	handler := NewChainHandler(name, chainConfig, client)
+	handler.Publisher = s.publisher
+
+	status := &ChainStatus{
+		Chain:     name,
+		ChainID:   handler.ChainID,
+		State:     "starting",
+		UpdatedAt: time.Now(),
+	}
+	s.statuses[name] = status
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	s.listeners[name] = listener{cancel: cancel, done: done}
+
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		defer close(done)
+		s.supervise(ctx, handler, status)
+	}()
+}
+
+// Stop stops the listener of the chain called name, so chains removed by a
+// config reload are no longer listened to, and waits until it finished the
+// block it was applying. A later Ensure starts it again.
+func (s *Supervisor) Stop(name string) {
+	s.mu.Lock()
+	l, ok := s.listeners[name]
+	delete(s.listeners, name)
+	delete(s.statuses, name)
+	s.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	l.cancel()
+	<-l.done
+}
+
+// Wait blocks until every listener stopped after the context passed to Start
+// was cancelled, or until timeout elapses. It reports whether all listeners
+// stopped in time.
+func (s *Supervisor) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (s *Supervisor) supervise(ctx context.Context, handler EVMHandler, status *ChainStatus) {
+	delay := minRestartDelay
+
+	for {
+		started := time.Now()
+		err := runListener(ctx, handler, s.db, status)
+		if ctx.Err() != nil {
+			if err != nil && !errors.Is(err, ctx.Err()) {
+				log.Printf("%s listener stopped: %v", handler.GetChainName(), err)
+			}
+			status.setState("stopped")
+			return
+		}
+
+		if time.Since(started) > maxRestartDelay {
+			delay = minRestartDelay
+		}
+
+		log.Printf("%s listener stopped, restarting in %s: %v", handler.GetChainName(), delay, err)
+		status.fail(err)
+		sleep(ctx, delay)
+		delay = min(delay*2, maxRestartDelay)
+	}
+}
+
+// runListener runs the listener of handler, turning panics into errors so a
+// bug in one chain's adapters does not take down the others.
+func runListener(ctx context.Context, handler EVMHandler, db *pop.Connection, status *ChainStatus) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return RunBlockListener(ctx, handler, db, status)
+}
+
+// Statuses returns a snapshot of every listener's status, sorted by chain.
+func (s *Supervisor) Statuses() []ChainStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]ChainStatus, 0, len(s.statuses))
+	for _, status := range s.statuses {
+		result = append(result, status.snapshot())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Chain < result[j].Chain
+	})
+	return result
+}
+
+func (cs *ChainStatus) snapshot() ChainStatus {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return ChainStatus{
+		Chain:     cs.Chain,
+		ChainID:   cs.ChainID,
+		State:     cs.State,
+		LastBlock: cs.LastBlock,
+		Finalized: cs.Finalized,
+		Head:      cs.Head,
+		Lag:       cs.Lag,
+		Restarts:  cs.Restarts,
+		LastError: cs.LastError,
+		UpdatedAt: cs.UpdatedAt,
+	}
+}
+
+func (cs *ChainStatus) setState(state string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.State = state
+	cs.UpdatedAt = time.Now()
+}
+
+func (cs *ChainStatus) setHead(head int64) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.Head = max(cs.Head, head)
+	cs.Lag = max(cs.Head-cs.LastBlock, 0)
+	cs.UpdatedAt = time.Now()
+}
+
+func (cs *ChainStatus) advance(block int64) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.LastBlock = block
+	cs.Head = max(cs.Head, block)
+	cs.Lag = cs.Head - block
+	cs.UpdatedAt = time.Now()
+}
+
+func (cs *ChainStatus) finalize(block int64) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.Finalized = max(block, 0)
+	cs.UpdatedAt = time.Now()
+}
+
+func (cs *ChainStatus) fail(err error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.State = "restarting"
+	cs.Restarts++
+	if err != nil {
+		cs.LastError = err.Error()
+	}
+	cs.UpdatedAt = time.Now()
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"dumb-api/config"
+	"dumb-api/internal/contracts"
+	"dumb-api/internal/dexes"
+	"dumb-api/internal/graph"
+	"dumb-api/internal/pricing"
+	"dumb-api/internal/rpcpool"
+	"dumb-api/internal/tokens"
+	"dumb-api/internal/tvl"
+	"dumb-api/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobuffalo/pop/v6"
+)
+
+// TVLInterval is how often the TVL of every pool and bridge is recomputed.
+const TVLInterval = 5 * time.Minute
+
+// TVLTracker periodically values the balances of every pool of the global
+// graph and the collateral held by the bridges of configured tokens.
+type TVLTracker struct {
+	db      *pop.Connection
+	clients rpcpool.Lookup
+}
+
+// NewTVLTracker creates a tracker reading bridge collateral through the RPC
+// provider pools clients finds.
+func NewTVLTracker(db *pop.Connection, clients rpcpool.Lookup) *TVLTracker {
+	return &TVLTracker{db: db, clients: clients}
+}
+
+// Start updates the TVL every TVLInterval until ctx is cancelled.
+func (t *TVLTracker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(TVLInterval)
+		defer ticker.Stop()
+
+		for {
+			t.Update(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Update records the current TVL of every pool and bridge, then drops the
+// pools that were not updated for two rounds, which are no longer tracked.
+func (t *TVLTracker) Update(ctx context.Context) {
+	g := graph.GetGlobalGraph()
+	if g == nil {
+		return
+	}
+
+	started := time.Now()
+
+	g.Mu.RLock()
+	pools := make([]*graph.Pool, 0, len(g.Pools))
+	for _, pool := range g.Pools {
+		pools = append(pools, pool)
+	}
+	g.Mu.RUnlock()
+
+	var recorded int
+	db := t.db.WithContext(ctx)
+	for _, pool := range pools {
+		if ctx.Err() != nil {
+			return
+		}
+		reader, ok := dexes.AdapterFor(pool).(dexes.BalanceReader)
+		if !ok {
+			continue
+		}
+		balance0, balance1, err := reader.PoolBalances(ctx, g, pool)
+		if err != nil {
+			log.Printf("Failed to get balances of pool %s: %v", pool.Pair, err)
+			continue
+		}
+
+		row := newPoolTVL(pool.Chain, pool.Pair, pool.Dex, pool.Token0, pool.Token1, balance0, balance1)
+		if err := tvl.Record(db, row); err != nil {
+			log.Print(err)
+			continue
+		}
+		recorded++
+	}
+
+	recorded += t.updateBridges(ctx, db)
+	if ctx.Err() != nil {
+		return
+	}
+	if err := tvl.Prune(db, started.Add(-2*TVLInterval)); err != nil {
+		log.Printf("Failed to prune TVL of untracked pools: %v", err)
+	}
+	log.Printf("Updated the TVL of %d pools and bridges in %s", recorded, time.Since(started).Round(time.Millisecond))
+}
+
+// updateBridges records the collateral held by the token home contract of
+// every configured token bridged from its chain.
+func (t *TVLTracker) updateBridges(ctx context.Context, db *pop.Connection) int {
+	var recorded int
+	for chainName, chainConfig := range config.GetEVMConfig() {
+		client, ok := t.clients(chainName)
+		if !ok {
+			continue
+		}
+		chain := strings.ToLower(chainName)
+
+		for _, token := range chainConfig.Tokens {
+			// Tokens native to a remote chain name themselves as home.
+			if token.TokenHome == "" || strings.EqualFold(token.TokenHome, token.Address) {
+				continue
+			}
+			if ctx.Err() != nil {
+				return recorded
+			}
+
+			address, home := common.HexToAddress(token.Address), common.HexToAddress(token.TokenHome)
+			balance, err := contracts.BalanceOf(ctx, client, address, home)
+			if err != nil {
+				log.Printf("Failed to get %s collateral of bridge %s: %v", token.Symbol, home, err)
+				continue
+			}
+
+			row := newPoolTVL(chain, home.Hex(), tvl.Bridge, address.Hex(), "", balance, nil)
+			if err := tvl.Record(db, row); err != nil {
+				log.Print(err)
+				continue
+			}
+			recorded++
+		}
+	}
+	return recorded
+}
+
+// newPoolTVL values balance0 of token0 and balance1 of token1, either of
+// which may be missing, at their current USD prices.
+func newPoolTVL(chain, pool, dex, token0, token1 string, balance0, balance1 *big.Int) *models.PoolTVL {
+	row := &models.PoolTVL{
+		Chain:     chain,
+		Pool:      common.HexToAddress(pool).Hex(),
+		Dex:       dex,
+		Token0:    common.HexToAddress(token0).Hex(),
+		UpdatedAt: time.Now(),
+	}
+	if token1 != "" {
+		row.Token1 = common.HexToAddress(token1).Hex()
+	}
+
+	value := func(token string, balance *big.Int) (float64, float64) {
+		if token == "" || balance == nil {
+			return 0, 0
+		}
+		address := common.HexToAddress(token)
+		decimals, ok := tokens.Decimals(chain, address)
+		if !ok {
+			return 0, 0
+		}
+		amount := tokens.Normalize(balance, decimals)
+		price, _ := pricing.USDPrice(chain, address)
+		return amount, amount * price
+	}
+	row.Amount0, row.Amount0USD = value(row.Token0, balance0)
+	row.Amount1, row.Amount1USD = value(row.Token1, balance1)
+	row.TVLUSD = row.Amount0USD + row.Amount1USD
+	return row
+}
@@ -0,0 +1,126 @@
+// Package streams fans the pool changes applied to the global graph out to
+// the quote streams open in this process, so they requote when the graph
+// changes instead of polling it. It also remembers the last block that
+// changed each pool since the process started.
+package streams
+
+import (
+	"errors"
+	"sync"
+
+	"dumb-api/internal/graph"
+)
+
+// ErrTooManySubscriptions is returned when a client already holds as many
+// subscriptions as it is allowed.
+var ErrTooManySubscriptions = errors.New("too many open subscriptions")
+
+// Subscription receives the pool changes applied after it was opened.
+// Changes accumulate until taken, so a slow reader only misses intermediate
+// states, never a changed pool.
+type Subscription struct {
+	client string
+	wake   chan struct{}
+
+	mu sync.Mutex
+	// pending are the addresses of the pools changed since the last Take.
+	pending map[string]bool
+}
+
+var (
+	mu            sync.Mutex
+	subscriptions = make(map[*Subscription]bool)
+	perClient     = make(map[string]int)
+	blocks        = make(map[string]int64)
+	poolBlocks    = make(map[string]int64)
+)
+
+// Subscribe opens a subscription for client, which can hold at most limit
+// of them at once.
+func Subscribe(client string, limit int) (*Subscription, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if perClient[client] >= limit {
+		return nil, ErrTooManySubscriptions
+	}
+	perClient[client]++
+
+	s := &Subscription{client: client, wake: make(chan struct{}, 1)}
+	subscriptions[s] = true
+	return s, nil
+}
+
+// Close stops the subscription and frees its slot.
+func (s *Subscription) Close() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !subscriptions[s] {
+		return
+	}
+	delete(subscriptions, s)
+	if perClient[s.client]--; perClient[s.client] == 0 {
+		delete(perClient, s.client)
+	}
+}
+
+// C receives a value when changes are pending.
+func (s *Subscription) C() <-chan struct{} {
+	return s.wake
+}
+
+// Take returns the addresses of the pools changed since the last call.
+func (s *Subscription) Take() map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pools := s.pending
+	s.pending = nil
+	return pools
+}
+
+// Notify reports that pools of chain changed with block, which a rollback
+// may set below the previous block. The caller must have applied the
+// changes to the global graph already.
+func Notify(chain string, block int64, pools ...*graph.Pool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	blocks[chain] = block
+	for _, pool := range pools {
+		poolBlocks[pool.Pair] = block
+	}
+	for s := range subscriptions {
+		s.mu.Lock()
+		if s.pending == nil {
+			s.pending = make(map[string]bool)
+		}
+		for _, pool := range pools {
+			s.pending[pool.Pair] = true
+		}
+		s.mu.Unlock()
+
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Block returns the newest block notified for chain, zero before the first
+// notification.
+func Block(chain string) int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return blocks[chain]
+}
+
+// PoolBlock returns the last block notified for pool, or false when it has
+// not changed since the process started.
+func PoolBlock(pool string) (int64, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	block, ok := poolBlocks[pool]
+	return block, ok
+}
@@ -0,0 +1,120 @@
+// Package tokens looks up token metadata and prices recorded in the tokens
+// table, caching them since they are read for every price tick and swap.
+package tokens
+
+import (
+	"log"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dumb-api/config"
+	"dumb-api/models"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// missRetry is how long a token missing from the tokens table is not
+	// looked up again.
+	missRetry = time.Minute
+
+	// priceTTL is how long a USD price is served from the cache.
+	priceTTL = time.Minute
+)
+
+type entry struct {
+	value   float64
+	ok      bool
+	checked time.Time
+}
+
+var (
+	mu       sync.Mutex
+	decimals = make(map[string]entry)
+	prices   = make(map[string]entry)
+)
+
+// Decimals returns the decimals of token on chain, named as in the graph.
+func Decimals(chain string, token common.Address) (int, bool) {
+	value, ok := lookup(decimals, chain, token, 0, func(row models.Token) float64 {
+		return float64(row.Decimals)
+	})
+	return int(value), ok
+}
+
+// SetDecimals caches the decimals of a token missing from the tokens table,
+// read from its contract.
+func SetDecimals(chain string, token common.Address, value int) {
+	key, ok := cacheKey(chain, token)
+	if !ok {
+		return
+	}
+	mu.Lock()
+	decimals[key] = entry{value: float64(value), ok: true, checked: time.Now()}
+	mu.Unlock()
+}
+
+// USDPrice returns the latest USD price of token on chain.
+func USDPrice(chain string, token common.Address) (float64, bool) {
+	price, ok := lookup(prices, chain, token, priceTTL, func(row models.Token) float64 {
+		return row.Price
+	})
+	return price, ok && price > 0
+}
+
+// lookup returns field of the latest tokens row of token, caching hits for
+// ttl (forever when zero) and misses for missRetry.
+func lookup(cache map[string]entry, chain string, token common.Address, ttl time.Duration, field func(models.Token) float64) (float64, bool) {
+	key, ok := cacheKey(chain, token)
+	if !ok {
+		return 0, false
+	}
+	chainID, address, _ := strings.Cut(key, ":")
+
+	mu.Lock()
+	cached, found := cache[key]
+	mu.Unlock()
+	if found {
+		age := time.Since(cached.checked)
+		if (cached.ok && (ttl == 0 || age < ttl)) || (!cached.ok && age < missRetry) {
+			return cached.value, cached.ok
+		}
+	}
+
+	var row models.Token
+	err := models.DB.Where("chain_id = ? AND LOWER(address) = ?", chainID, address).
+		Order("updated_at desc").First(&row)
+	result := entry{ok: err == nil, checked: time.Now()}
+	if result.ok {
+		result.value = field(row)
+	} else if !found {
+		log.Printf("Token %s on %s is not in the tokens table: %v", token, chain, err)
+	}
+
+	mu.Lock()
+	cache[key] = result
+	mu.Unlock()
+
+	return result.value, result.ok
+}
+
+// cacheKey returns the chain id and lowercase address of token, separated by
+// a colon, which is how the tokens table identifies it.
+func cacheKey(chain string, token common.Address) (string, bool) {
+	chainConfig, ok := config.GetChainConfig(chain)
+	if !ok {
+		return "", false
+	}
+	return strconv.Itoa(chainConfig.ChainId) + ":" + strings.ToLower(token.Hex()), true
+}
+
+// Normalize converts amount raw units of a token with decimals into whole
+// tokens.
+func Normalize(amount *big.Int, decimals int) float64 {
+	scale := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	normalized, _ := new(big.Float).Quo(new(big.Float).SetInt(amount), scale).Float64()
+	return normalized
+}
@@ -0,0 +1,137 @@
+// Package tvl stores the value locked in pools and bridges, keeping the
+// latest value of each and an hourly history, and aggregates it per token
+// and per chain.
+package tvl
+
+import (
+	"fmt"
+	"time"
+
+	"dumb-api/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobuffalo/pop/v6"
+)
+
+// Bridge is the Dex of the rows holding the collateral of a bridged token.
+const Bridge = "bridge"
+
+// HistoryInterval is the width of the buckets of the TVL history.
+const HistoryInterval = time.Hour
+
+// Point is the TVL of a token at the start of a history bucket. Amount is
+// denominated in the token.
+type Point struct {
+	Bucket time.Time `json:"bucket" db:"bucket"`
+	Amount float64   `json:"amount" db:"amount"`
+	TVLUSD float64   `json:"tvlUsd" db:"tvl_usd"`
+}
+
+// TokenTVL is the amount of a token locked on one chain and its value.
+type TokenTVL struct {
+	Chain  string  `json:"chain" db:"chain"`
+	Amount float64 `json:"amount" db:"amount"`
+	TVLUSD float64 `json:"tvlUsd" db:"tvl_usd"`
+}
+
+// ChainTVL is the value locked in every pool and bridge of a chain.
+type ChainTVL struct {
+	Chain  string  `json:"chain" db:"chain"`
+	TVLUSD float64 `json:"tvlUsd" db:"tvl_usd"`
+	Pools  int     `json:"pools" db:"pools"`
+}
+
+// Record stores row as the latest TVL of its pool and as the value of the
+// history bucket its UpdatedAt falls into, replacing earlier values of that
+// bucket.
+func Record(db *pop.Connection, row *models.PoolTVL) error {
+	args := []interface{}{
+		row.Chain, row.Pool, row.Dex, row.Token0, row.Token1,
+		row.Amount0, row.Amount1, row.Amount0USD, row.Amount1USD, row.TVLUSD, row.UpdatedAt,
+	}
+	const update = `dex = EXCLUDED.dex, token1 = EXCLUDED.token1,
+		amount0 = EXCLUDED.amount0, amount1 = EXCLUDED.amount1,
+		amount0_usd = EXCLUDED.amount0_usd, amount1_usd = EXCLUDED.amount1_usd,
+		tvl_usd = EXCLUDED.tvl_usd, updated_at = EXCLUDED.updated_at`
+
+	err := db.RawQuery(
+		`INSERT INTO pool_tvl (chain, pool, dex, token0, token1, amount0, amount1, amount0_usd, amount1_usd, tvl_usd, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chain, pool, token0) DO UPDATE SET `+update,
+		args...,
+	).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to record TVL of %s: %w", row.Pool, err)
+	}
+
+	err = db.RawQuery(
+		`INSERT INTO pool_tvl_history (chain, pool, dex, token0, token1, amount0, amount1, amount0_usd, amount1_usd, tvl_usd, updated_at, bucket)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chain, pool, token0, bucket) DO UPDATE SET `+update,
+		append(args, row.UpdatedAt.UTC().Truncate(HistoryInterval))...,
+	).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to record TVL history of %s: %w", row.Pool, err)
+	}
+	return nil
+}
+
+// Prune deletes the latest TVL of pools not updated since before, which are
+// no longer tracked. Their history is kept.
+func Prune(db *pop.Connection, before time.Time) error {
+	return db.RawQuery("DELETE FROM pool_tvl WHERE updated_at < ?", before).Exec()
+}
+
+// Chains returns the latest TVL of every chain.
+func Chains(db *pop.Connection) ([]ChainTVL, error) {
+	var rows []ChainTVL
+	err := db.RawQuery(
+		`SELECT chain, COALESCE(SUM(tvl_usd), 0) AS tvl_usd, COUNT(*) AS pools
+		FROM pool_tvl GROUP BY chain ORDER BY tvl_usd DESC`,
+	).All(&rows)
+	return rows, err
+}
+
+// Token returns the latest amount of token locked in pools and bridges, per
+// chain, restricted to chain when it is not empty.
+func Token(db *pop.Connection, chain, token string) ([]TokenTVL, error) {
+	where, args := tokenFilter(chain, token)
+	var rows []TokenTVL
+	err := db.RawQuery(
+		`SELECT chain,
+			COALESCE(SUM(CASE WHEN token0 = ? THEN amount0 ELSE amount1 END), 0) AS amount,
+			COALESCE(SUM(CASE WHEN token0 = ? THEN amount0_usd ELSE amount1_usd END), 0) AS tvl_usd
+		FROM pool_tvl WHERE `+where+` GROUP BY chain ORDER BY tvl_usd DESC`,
+		args...,
+	).All(&rows)
+	return rows, err
+}
+
+// TokenHistory returns the hourly amount of token locked in pools and
+// bridges since from, oldest first, restricted to chain when it is not
+// empty.
+func TokenHistory(db *pop.Connection, chain, token string, from time.Time) ([]Point, error) {
+	where, args := tokenFilter(chain, token)
+	var rows []Point
+	err := db.RawQuery(
+		`SELECT bucket,
+			COALESCE(SUM(CASE WHEN token0 = ? THEN amount0 ELSE amount1 END), 0) AS amount,
+			COALESCE(SUM(CASE WHEN token0 = ? THEN amount0_usd ELSE amount1_usd END), 0) AS tvl_usd
+		FROM pool_tvl_history WHERE `+where+` AND bucket >= ? GROUP BY bucket ORDER BY bucket`,
+		append(args, from.UTC().Truncate(HistoryInterval))...,
+	).All(&rows)
+	return rows, err
+}
+
+// tokenFilter returns the condition matching the rows holding token and the
+// arguments of the aggregates selecting its side followed by its own.
+func tokenFilter(chain, token string) (string, []interface{}) {
+	address := common.HexToAddress(token).Hex()
+	where := "(token0 = ? OR token1 = ?)"
+	args := []interface{}{address, address, address, address}
+	if chain != "" {
+		where += " AND chain = ?"
+		args = append(args, chain)
+	}
+	return where, args
+}
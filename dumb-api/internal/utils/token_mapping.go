@@ -13,7 +13,7 @@ func GetTokenMappings(token, chain string) (string, string) {
 
 	// Convert chain name to uppercase to match config
 	chainUpper := strings.ToUpper(chain)
-	chainConfig, exists := config.EVMConfig[chainUpper]
+	chainConfig, exists := config.GetChainConfig(chainUpper)
 	if !exists {
 		log.Printf("Chain %s (as %s) not found in EVMConfig", chain, chainUpper)
 		return "", ""
@@ -0,0 +1,158 @@
+// Package volume indexes swaps and aggregates them into rolling volume and
+// trade counts per pool, token and chain.
+package volume
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"dumb-api/internal/pricing"
+	"dumb-api/internal/tokens"
+	"dumb-api/models"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gobuffalo/pop/v6"
+)
+
+// Window is a rolling period volume is reported over.
+type Window struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Windows are the periods every volume query reports.
+var Windows = []Window{
+	{Name: "1h", Duration: time.Hour},
+	{Name: "24h", Duration: 24 * time.Hour},
+	{Name: "7d", Duration: 7 * 24 * time.Hour},
+}
+
+// Stats is the volume of one window. Volume is denominated in the token the
+// stats were queried for and is zero for pool and chain stats, which report
+// Volume0 and Volume1 or only USD instead.
+type Stats struct {
+	VolumeUSD float64 `json:"volumeUsd"`
+	Volume    float64 `json:"volume,omitempty"`
+	Volume0   float64 `json:"volume0,omitempty"`
+	Volume1   float64 `json:"volume1,omitempty"`
+	Trades    int     `json:"trades"`
+}
+
+// NewSwap builds the row of a swap of amount0 and amount1 raw units into
+// pool. Volumes are normalized by the decimals of the tokens and valued at
+// the USD price of token0, or of token1 when token0 has none.
+func NewSwap(chain, pool, dex, token0, token1 string, amount0, amount1 *big.Int) *models.Swap {
+	swap := &models.Swap{
+		Chain:   chain,
+		Pool:    common.HexToAddress(pool).Hex(),
+		Dex:     dex,
+		Token0:  common.HexToAddress(token0).Hex(),
+		Token1:  common.HexToAddress(token1).Hex(),
+		Amount0: amount0.String(),
+		Amount1: amount1.String(),
+	}
+
+	address0, address1 := common.HexToAddress(token0), common.HexToAddress(token1)
+	if decimals, ok := tokens.Decimals(chain, address0); ok {
+		swap.Volume0 = tokens.Normalize(new(big.Int).Abs(amount0), decimals)
+	}
+	if decimals, ok := tokens.Decimals(chain, address1); ok {
+		swap.Volume1 = tokens.Normalize(new(big.Int).Abs(amount1), decimals)
+	}
+
+	if price, ok := pricing.USDPrice(chain, address0); ok && swap.Volume0 > 0 {
+		swap.AmountUSD = swap.Volume0 * price
+	} else if price, ok := pricing.USDPrice(chain, address1); ok && swap.Volume1 > 0 {
+		swap.AmountUSD = swap.Volume1 * price
+	}
+
+	return swap
+}
+
+// Record stores swap. Swaps already indexed, as when blocks are applied again
+// after a restart, are ignored.
+func Record(db *pop.Connection, swap *models.Swap) error {
+	err := db.RawQuery(
+		`INSERT INTO swaps (chain, pool, dex, token0, token1, amount0, amount1, volume0, volume1, amount_usd, block_number, tx_hash, log_index, traded_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (chain, tx_hash, log_index) DO NOTHING`,
+		swap.Chain, swap.Pool, swap.Dex, swap.Token0, swap.Token1, swap.Amount0, swap.Amount1,
+		swap.Volume0, swap.Volume1, swap.AmountUSD, swap.BlockNumber, swap.TxHash, swap.LogIndex, swap.TradedAt,
+	).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to record swap %s:%d: %w", swap.TxHash, swap.LogIndex, err)
+	}
+	return nil
+}
+
+// Rollback deletes the swaps of chain indexed from blocks after block.
+func Rollback(db *pop.Connection, chain string, block int64) error {
+	err := db.RawQuery("DELETE FROM swaps WHERE chain = ? AND block_number > ?", chain, block).Exec()
+	if err != nil {
+		return fmt.Errorf("failed to roll back %s swaps to block %d: %w", chain, block, err)
+	}
+	return nil
+}
+
+// PoolStats returns the volume of pool per window.
+func PoolStats(db *pop.Connection, pool string) (map[string]Stats, error) {
+	return stats(db,
+		"SUM(volume0) AS volume0, SUM(volume1) AS volume1, 0 AS volume",
+		"pool = ?", common.HexToAddress(pool).Hex())
+}
+
+// TokenStats returns the volume of token per window, across the pools of
+// chain or of every chain when chain is empty.
+func TokenStats(db *pop.Connection, chain, token string) (map[string]Stats, error) {
+	address := common.HexToAddress(token).Hex()
+	where := "(token0 = ? OR token1 = ?)"
+	args := []interface{}{address, address, address}
+	if chain != "" {
+		where += " AND chain = ?"
+		args = append(args, chain)
+	}
+	return stats(db,
+		"0 AS volume0, 0 AS volume1, SUM(CASE WHEN token0 = ? THEN volume0 ELSE volume1 END) AS volume",
+		where, args...)
+}
+
+// ChainStats returns the volume of every pool of chain per window.
+func ChainStats(db *pop.Connection, chain string) (map[string]Stats, error) {
+	return stats(db, "0 AS volume0, 0 AS volume1, 0 AS volume", "chain = ?", chain)
+}
+
+// stats sums the swaps matching where over every window. volumes selects the
+// volume0, volume1 and volume columns; args fill the placeholders of volumes
+// then of where.
+func stats(db *pop.Connection, volumes, where string, args ...interface{}) (map[string]Stats, error) {
+	query := fmt.Sprintf(
+		`SELECT COALESCE(SUM(amount_usd), 0) AS volume_usd, COUNT(*) AS trades, %s
+		FROM swaps WHERE %s AND traded_at >= ?`, volumes, where)
+
+	result := make(map[string]Stats, len(Windows))
+	now := time.Now()
+	for _, window := range Windows {
+		var row struct {
+			VolumeUSD float64         `db:"volume_usd"`
+			Trades    int             `db:"trades"`
+			Volume0   sql.NullFloat64 `db:"volume0"`
+			Volume1   sql.NullFloat64 `db:"volume1"`
+			Volume    sql.NullFloat64 `db:"volume"`
+		}
+		windowArgs := append(append([]interface{}{}, args...), now.Add(-window.Duration))
+		if err := db.RawQuery(query, windowArgs...).First(&row); err != nil {
+			return nil, fmt.Errorf("failed to sum %s volume: %w", window.Name, err)
+		}
+
+		result[window.Name] = Stats{
+			VolumeUSD: row.VolumeUSD,
+			Volume:    row.Volume.Float64,
+			Volume0:   row.Volume0.Float64,
+			Volume1:   row.Volume1.Float64,
+			Trades:    row.Trades,
+		}
+	}
+	return result, nil
+}
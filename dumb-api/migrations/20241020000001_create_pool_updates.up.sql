@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS pool_updates (
+    id BIGSERIAL PRIMARY KEY,
+    chain_id VARCHAR(255) NOT NULL,
+    pool VARCHAR(42) NOT NULL,
+    dex VARCHAR(50) NOT NULL,
+    block_number BIGINT NOT NULL,
+    state BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_pool_updates_created_at ON pool_updates(created_at);
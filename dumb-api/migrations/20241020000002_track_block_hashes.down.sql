@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS block_hashes;
+
+ALTER TABLE chain_states DROP COLUMN IF EXISTS last_block_hash;
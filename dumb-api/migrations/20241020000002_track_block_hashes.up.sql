@@ -0,0 +1,10 @@
+ALTER TABLE chain_states ADD COLUMN IF NOT EXISTS last_block_hash VARCHAR(66) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS block_hashes (
+    chain_id VARCHAR(255) NOT NULL,
+    block_number BIGINT NOT NULL,
+    block_hash VARCHAR(66) NOT NULL,
+    parent_hash VARCHAR(66) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chain_id, block_number)
+);
@@ -0,0 +1 @@
+ALTER TABLE pool_updates DROP COLUMN IF EXISTS finalized;
@@ -0,0 +1 @@
+ALTER TABLE pool_updates ADD COLUMN IF NOT EXISTS finalized BOOLEAN NOT NULL DEFAULT FALSE;
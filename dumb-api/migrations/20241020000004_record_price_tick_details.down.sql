@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_price_ticks_pair_created_at;
+
+ALTER TABLE price_ticks DROP COLUMN IF EXISTS tx_hash;
+ALTER TABLE price_ticks DROP COLUMN IF EXISTS block_number;
+ALTER TABLE price_ticks DROP COLUMN IF EXISTS pool;
+ALTER TABLE price_ticks DROP COLUMN IF EXISTS amount_out;
+ALTER TABLE price_ticks DROP COLUMN IF EXISTS amount_in;
+ALTER TABLE price_ticks DROP COLUMN IF EXISTS price;
@@ -0,0 +1,11 @@
+ALTER TABLE price_ticks ADD COLUMN IF NOT EXISTS price DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE price_ticks ADD COLUMN IF NOT EXISTS amount_in DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE price_ticks ADD COLUMN IF NOT EXISTS amount_out DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE price_ticks ADD COLUMN IF NOT EXISTS pool VARCHAR(42) NOT NULL DEFAULT '';
+ALTER TABLE price_ticks ADD COLUMN IF NOT EXISTS block_number BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE price_ticks ADD COLUMN IF NOT EXISTS tx_hash VARCHAR(66) NOT NULL DEFAULT '';
+
+-- Ticks recorded before prices were stored carry no information.
+DELETE FROM price_ticks WHERE price = 0;
+
+CREATE INDEX IF NOT EXISTS idx_price_ticks_pair_created_at ON price_ticks(token_in, token_out, created_at);
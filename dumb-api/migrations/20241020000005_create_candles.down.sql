@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS candles_1d;
+DROP TABLE IF EXISTS candles_1h;
+DROP TABLE IF EXISTS candles_5m;
+DROP TABLE IF EXISTS candles_1m;
+
+ALTER TABLE price_ticks DROP COLUMN IF EXISTS volume;
@@ -0,0 +1,77 @@
+ALTER TABLE price_ticks ADD COLUMN IF NOT EXISTS volume DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS candles_1m (
+    chain VARCHAR(255) NOT NULL,
+    pool VARCHAR(42) NOT NULL,
+    token_in VARCHAR(255) NOT NULL,
+    token_out VARCHAR(255) NOT NULL,
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    open DOUBLE PRECISION NOT NULL,
+    high DOUBLE PRECISION NOT NULL,
+    low DOUBLE PRECISION NOT NULL,
+    close DOUBLE PRECISION NOT NULL,
+    volume DOUBLE PRECISION NOT NULL DEFAULT 0,
+    trade_count INTEGER NOT NULL DEFAULT 0,
+    opened_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    closed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (chain, pool, token_in, token_out, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_candles_1m_pair_bucket ON candles_1m(token_in, token_out, pool, bucket);
+
+CREATE TABLE IF NOT EXISTS candles_5m (
+    chain VARCHAR(255) NOT NULL,
+    pool VARCHAR(42) NOT NULL,
+    token_in VARCHAR(255) NOT NULL,
+    token_out VARCHAR(255) NOT NULL,
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    open DOUBLE PRECISION NOT NULL,
+    high DOUBLE PRECISION NOT NULL,
+    low DOUBLE PRECISION NOT NULL,
+    close DOUBLE PRECISION NOT NULL,
+    volume DOUBLE PRECISION NOT NULL DEFAULT 0,
+    trade_count INTEGER NOT NULL DEFAULT 0,
+    opened_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    closed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (chain, pool, token_in, token_out, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_candles_5m_pair_bucket ON candles_5m(token_in, token_out, pool, bucket);
+
+CREATE TABLE IF NOT EXISTS candles_1h (
+    chain VARCHAR(255) NOT NULL,
+    pool VARCHAR(42) NOT NULL,
+    token_in VARCHAR(255) NOT NULL,
+    token_out VARCHAR(255) NOT NULL,
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    open DOUBLE PRECISION NOT NULL,
+    high DOUBLE PRECISION NOT NULL,
+    low DOUBLE PRECISION NOT NULL,
+    close DOUBLE PRECISION NOT NULL,
+    volume DOUBLE PRECISION NOT NULL DEFAULT 0,
+    trade_count INTEGER NOT NULL DEFAULT 0,
+    opened_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    closed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (chain, pool, token_in, token_out, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_candles_1h_pair_bucket ON candles_1h(token_in, token_out, pool, bucket);
+
+CREATE TABLE IF NOT EXISTS candles_1d (
+    chain VARCHAR(255) NOT NULL,
+    pool VARCHAR(42) NOT NULL,
+    token_in VARCHAR(255) NOT NULL,
+    token_out VARCHAR(255) NOT NULL,
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    open DOUBLE PRECISION NOT NULL,
+    high DOUBLE PRECISION NOT NULL,
+    low DOUBLE PRECISION NOT NULL,
+    close DOUBLE PRECISION NOT NULL,
+    volume DOUBLE PRECISION NOT NULL DEFAULT 0,
+    trade_count INTEGER NOT NULL DEFAULT 0,
+    opened_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    closed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (chain, pool, token_in, token_out, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_candles_1d_pair_bucket ON candles_1d(token_in, token_out, pool, bucket);
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS swaps (
+    id BIGSERIAL PRIMARY KEY,
+    chain VARCHAR(255) NOT NULL,
+    pool VARCHAR(42) NOT NULL,
+    dex VARCHAR(255) NOT NULL,
+    token0 VARCHAR(42) NOT NULL,
+    token1 VARCHAR(42) NOT NULL,
+    amount0 NUMERIC(78, 0) NOT NULL,
+    amount1 NUMERIC(78, 0) NOT NULL,
+    volume0 DOUBLE PRECISION NOT NULL DEFAULT 0,
+    volume1 DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amount_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    block_number BIGINT NOT NULL,
+    tx_hash VARCHAR(66) NOT NULL,
+    log_index INTEGER NOT NULL,
+    traded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    UNIQUE (chain, tx_hash, log_index)
+);
+
+CREATE INDEX IF NOT EXISTS idx_swaps_pool_traded_at ON swaps(pool, traded_at);
+CREATE INDEX IF NOT EXISTS idx_swaps_token0_traded_at ON swaps(token0, traded_at);
+CREATE INDEX IF NOT EXISTS idx_swaps_token1_traded_at ON swaps(token1, traded_at);
+CREATE INDEX IF NOT EXISTS idx_swaps_chain_traded_at ON swaps(chain, traded_at);
+CREATE INDEX IF NOT EXISTS idx_swaps_chain_block_number ON swaps(chain, block_number);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS pool_tvl_history;
+DROP TABLE IF EXISTS pool_tvl;
@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS pool_tvl (
+    chain VARCHAR(255) NOT NULL,
+    pool VARCHAR(42) NOT NULL,
+    dex VARCHAR(255) NOT NULL,
+    token0 VARCHAR(42) NOT NULL,
+    token1 VARCHAR(42) NOT NULL DEFAULT '',
+    amount0 DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amount1 DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amount0_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amount1_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    tvl_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (chain, pool, token0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pool_tvl_token0 ON pool_tvl(token0);
+CREATE INDEX IF NOT EXISTS idx_pool_tvl_token1 ON pool_tvl(token1);
+
+CREATE TABLE IF NOT EXISTS pool_tvl_history (
+    chain VARCHAR(255) NOT NULL,
+    pool VARCHAR(42) NOT NULL,
+    dex VARCHAR(255) NOT NULL,
+    token0 VARCHAR(42) NOT NULL,
+    token1 VARCHAR(42) NOT NULL DEFAULT '',
+    bucket TIMESTAMP WITH TIME ZONE NOT NULL,
+    amount0 DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amount1 DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amount0_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amount1_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    tvl_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (chain, pool, token0, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pool_tvl_history_token0_bucket ON pool_tvl_history(token0, bucket);
+CREATE INDEX IF NOT EXISTS idx_pool_tvl_history_token1_bucket ON pool_tvl_history(token1, bucket);
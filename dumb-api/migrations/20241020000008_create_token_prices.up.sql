@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS token_prices (
+    chain VARCHAR(255) NOT NULL,
+    address VARCHAR(42) NOT NULL,
+    price_usd DOUBLE PRECISION NOT NULL,
+    confidence DOUBLE PRECISION NOT NULL DEFAULT 0,
+    depth_usd DOUBLE PRECISION NOT NULL DEFAULT 0,
+    source VARCHAR(32) NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (chain, address)
+);
@@ -0,0 +1,25 @@
+CREATE TABLE price_ticks_unpartitioned (
+    id UUID DEFAULT gen_random_uuid() NOT NULL,
+    token_in VARCHAR(255) NOT NULL,
+    token_out VARCHAR(255) NOT NULL,
+    chain VARCHAR(255) NOT NULL,
+    price DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amount_in DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amount_out DOUBLE PRECISION NOT NULL DEFAULT 0,
+    volume DOUBLE PRECISION NOT NULL DEFAULT 0,
+    pool VARCHAR(42) NOT NULL DEFAULT '',
+    block_number BIGINT NOT NULL DEFAULT 0,
+    tx_hash VARCHAR(66) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+INSERT INTO price_ticks_unpartitioned (id, token_in, token_out, chain, price, amount_in, amount_out, volume, pool, block_number, tx_hash, created_at, updated_at)
+SELECT id, token_in, token_out, chain, price, amount_in, amount_out, volume, pool, block_number, tx_hash, created_at, updated_at
+FROM price_ticks;
+
+DROP TABLE price_ticks;
+ALTER TABLE price_ticks_unpartitioned RENAME TO price_ticks;
+ALTER TABLE price_ticks ADD CONSTRAINT price_ticks_pkey PRIMARY KEY (id);
+
+CREATE INDEX IF NOT EXISTS idx_price_ticks_pair_created_at ON price_ticks(token_in, token_out, created_at);
@@ -0,0 +1,54 @@
+-- price_ticks is partitioned by day so expired ticks are dropped with their
+-- partition instead of deleted row by row. Partitions are created for every
+-- day from the oldest existing tick on, so the migrated ticks expire with
+-- them, and the retention job creates the partitions of upcoming days; ticks
+-- outside of every daily partition land in price_ticks_default.
+ALTER TABLE price_ticks RENAME TO price_ticks_unpartitioned;
+ALTER TABLE price_ticks_unpartitioned RENAME CONSTRAINT price_ticks_pkey TO price_ticks_unpartitioned_pkey;
+DROP INDEX IF EXISTS idx_price_ticks_pair_created_at;
+
+CREATE TABLE price_ticks (
+    id UUID DEFAULT gen_random_uuid() NOT NULL,
+    token_in VARCHAR(255) NOT NULL,
+    token_out VARCHAR(255) NOT NULL,
+    chain VARCHAR(255) NOT NULL,
+    price DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amount_in DOUBLE PRECISION NOT NULL DEFAULT 0,
+    amount_out DOUBLE PRECISION NOT NULL DEFAULT 0,
+    volume DOUBLE PRECISION NOT NULL DEFAULT 0,
+    pool VARCHAR(42) NOT NULL DEFAULT '',
+    block_number BIGINT NOT NULL DEFAULT 0,
+    tx_hash VARCHAR(66) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+
+CREATE TABLE price_ticks_default PARTITION OF price_ticks DEFAULT;
+
+DO $$
+DECLARE
+    day DATE;
+BEGIN
+    FOR day IN SELECT generate_series(
+        LEAST((SELECT MIN(created_at AT TIME ZONE 'UTC')::DATE FROM price_ticks_unpartitioned), CURRENT_DATE - 7),
+        CURRENT_DATE + 7,
+        INTERVAL '1 day'
+    )::DATE LOOP
+        EXECUTE format(
+            'CREATE TABLE IF NOT EXISTS %I PARTITION OF price_ticks FOR VALUES FROM (%L) TO (%L)',
+            'price_ticks_' || to_char(day, 'YYYYMMDD'),
+            day::TIMESTAMP AT TIME ZONE 'UTC',
+            (day + 1)::TIMESTAMP AT TIME ZONE 'UTC'
+        );
+    END LOOP;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_price_ticks_pair_created_at ON price_ticks(token_in, token_out, created_at);
+CREATE INDEX IF NOT EXISTS idx_price_ticks_pool_created_at ON price_ticks(pool, created_at);
+
+INSERT INTO price_ticks (id, token_in, token_out, chain, price, amount_in, amount_out, volume, pool, block_number, tx_hash, created_at, updated_at)
+SELECT id, token_in, token_out, chain, price, amount_in, amount_out, volume, pool, block_number, tx_hash, created_at, updated_at
+FROM price_ticks_unpartitioned;
+
+DROP TABLE price_ticks_unpartitioned;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS pool_state_history (
+    id BIGSERIAL PRIMARY KEY,
+    chain VARCHAR(255) NOT NULL,
+    pool VARCHAR(42) NOT NULL,
+    dex VARCHAR(50) NOT NULL,
+    token0 VARCHAR(42) NOT NULL,
+    token1 VARCHAR(42) NOT NULL,
+    factory VARCHAR(42) NOT NULL,
+    block_number BIGINT NOT NULL,
+    block_time TIMESTAMP WITH TIME ZONE NOT NULL,
+    state BYTEA NOT NULL,
+    checkpoint BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (chain, pool, block_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pool_state_history_chain_block_number ON pool_state_history(chain, block_number);
+CREATE INDEX IF NOT EXISTS idx_pool_state_history_chain_block_time ON pool_state_history(chain, block_time);
+CREATE INDEX IF NOT EXISTS idx_pool_state_history_checkpoints ON pool_state_history(chain, block_number) WHERE checkpoint;
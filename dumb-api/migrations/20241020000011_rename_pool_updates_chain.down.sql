@@ -0,0 +1 @@
+ALTER TABLE pool_updates RENAME COLUMN chain TO chain_id;
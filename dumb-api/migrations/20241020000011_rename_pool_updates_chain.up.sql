@@ -0,0 +1,3 @@
+-- pool_updates.chain_id holds the chain name the graph keys pools by, not a
+-- chain id.
+ALTER TABLE pool_updates RENAME COLUMN chain_id TO chain;
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// BlockHash records the hash of an ingested block so that reorgs can be
+// traced back to the last block shared with the canonical chain.
+type BlockHash struct {
+	ChainID     string    `json:"chain_id" db:"chain_id"`
+	BlockNumber int64     `json:"block_number" db:"block_number"`
+	BlockHash   string    `json:"block_hash" db:"block_hash"`
+	ParentHash  string    `json:"parent_hash" db:"parent_hash"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// TableName returns the table name for this model
+func (b BlockHash) TableName() string {
+	return "block_hashes"
+}
+
+// String returns a JSON representation of BlockHash
+func (b BlockHash) String() string {
+	js, _ := json.Marshal(b)
+	return string(js)
+}
+
+// BlockHashes is a slice of BlockHash
+type BlockHashes []BlockHash
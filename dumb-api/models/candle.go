@@ -0,0 +1,34 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Candle aggregates the price ticks of a pair over one bucket of an
+// interval. Each interval has its own table, see the candles package. An
+// empty Pool aggregates the ticks of every pool of the pair.
+type Candle struct {
+	Chain      string    `json:"chain" db:"chain"`
+	Pool       string    `json:"pool" db:"pool"`
+	TokenIn    string    `json:"token_in" db:"token_in"`
+	TokenOut   string    `json:"token_out" db:"token_out"`
+	Bucket     time.Time `json:"bucket" db:"bucket"`
+	Open       float64   `json:"open" db:"open"`
+	High       float64   `json:"high" db:"high"`
+	Low        float64   `json:"low" db:"low"`
+	Close      float64   `json:"close" db:"close"`
+	Volume     float64   `json:"volume" db:"volume"`
+	TradeCount int       `json:"trade_count" db:"trade_count"`
+	OpenedAt   time.Time `json:"opened_at" db:"opened_at"`
+	ClosedAt   time.Time `json:"closed_at" db:"closed_at"`
+}
+
+// String returns a JSON representation of Candle
+func (c Candle) String() string {
+	js, _ := json.Marshal(c)
+	return string(js)
+}
+
+// Candles is a slice of Candle
+type Candles []Candle
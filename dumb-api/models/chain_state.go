@@ -9,11 +9,12 @@ import (
 )
 
 type ChainState struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	ChainID   string    `json:"chain_id" db:"chain_id"`
-	LastBlock int64     `json:"last_block" db:"last_block"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID            uuid.UUID `json:"id" db:"id"`
+	ChainID       string    `json:"chain_id" db:"chain_id"`
+	LastBlock     int64     `json:"last_block" db:"last_block"`
+	LastBlockHash string    `json:"last_block_hash" db:"last_block_hash"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
 }
 
 func (cs ChainState) TableName() string {
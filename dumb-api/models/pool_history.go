@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PoolHistory is the state of a pool, as exported by its DEX adapter, once
+// BlockNumber was applied. Checkpoint rows are written for every pool of a
+// chain at once, so the state of the chain at any later block is the
+// newest row of each pool since the last checkpoint.
+type PoolHistory struct {
+	ID          int64     `json:"-" db:"id"`
+	Chain       string    `json:"chain" db:"chain"`
+	Pool        string    `json:"pool" db:"pool"`
+	Dex         string    `json:"dex" db:"dex"`
+	Token0      string    `json:"token0" db:"token0"`
+	Token1      string    `json:"token1" db:"token1"`
+	Factory     string    `json:"factory" db:"factory"`
+	BlockNumber int64     `json:"blockNumber" db:"block_number"`
+	BlockTime   time.Time `json:"blockTime" db:"block_time"`
+	State       []byte    `json:"state" db:"state"`
+	Checkpoint  bool      `json:"checkpoint" db:"checkpoint"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+}
+
+// TableName returns the table name for this model
+func (p PoolHistory) TableName() string {
+	return "pool_state_history"
+}
+
+// String returns a JSON representation of PoolHistory
+func (p PoolHistory) String() string {
+	js, _ := json.Marshal(p)
+	return string(js)
+}
+
+// PoolHistories is a slice of PoolHistory
+type PoolHistories []PoolHistory
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PoolTVL is the value locked in a pool, or the collateral a bridge holds
+// for a token when Dex is "bridge". Amounts are normalized by the decimals of
+// the tokens and valued at the USD prices known when it was computed.
+type PoolTVL struct {
+	Chain      string    `json:"chain" db:"chain"`
+	Pool       string    `json:"pool" db:"pool"`
+	Dex        string    `json:"dex" db:"dex"`
+	Token0     string    `json:"token0" db:"token0"`
+	Token1     string    `json:"token1,omitempty" db:"token1"`
+	Amount0    float64   `json:"amount0" db:"amount0"`
+	Amount1    float64   `json:"amount1" db:"amount1"`
+	Amount0USD float64   `json:"amount0Usd" db:"amount0_usd"`
+	Amount1USD float64   `json:"amount1Usd" db:"amount1_usd"`
+	TVLUSD     float64   `json:"tvlUsd" db:"tvl_usd"`
+	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// String returns a JSON representation of PoolTVL
+func (p PoolTVL) String() string {
+	js, _ := json.Marshal(p)
+	return string(js)
+}
+
+// PoolTVLs is a slice of PoolTVL
+type PoolTVLs []PoolTVL
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// PoolUpdate is a decoded pool state change published by a standalone
+// listener for API replicas to apply. Finalized updates belong to the
+// finalized view rather than the latest one.
+type PoolUpdate struct {
+	ID          int64     `json:"id" db:"id"`
+	Chain       string    `json:"chain" db:"chain"`
+	Pool        string    `json:"pool" db:"pool"`
+	Dex         string    `json:"dex" db:"dex"`
+	BlockNumber int64     `json:"block_number" db:"block_number"`
+	State       []byte    `json:"state" db:"state"`
+	Finalized   bool      `json:"finalized" db:"finalized"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// TableName returns the table name for this model
+func (p PoolUpdate) TableName() string {
+	return "pool_updates"
+}
+
+// String returns a JSON representation of PoolUpdate
+func (p PoolUpdate) String() string {
+	js, _ := json.Marshal(p)
+	return string(js)
+}
+
+// PoolUpdates is a slice of PoolUpdate
+type PoolUpdates []PoolUpdate
@@ -9,16 +9,24 @@ import (
 	"github.com/gofrs/uuid"
 )
 
+// PriceTick is the price of TokenIn in TokenOut after a swap in Pool. Price
+// and amounts are normalized by the decimals of both tokens. Volume is the
+// amount of TokenIn the swap moved, in either direction, when the event
+// carries it.
 type PriceTick struct {
-	ID           uuid.UUID `db:"id"`
-	Price        float64   `db:"price"`
-	TokenIn      string    `db:"token_in"`
-	AmountIn     float64   `db:"amount_in"`
-	TokenOut     string    `db:"token_out"`
-	AmountOut    float64   `db:"amount_out"`
-	Chain        string    `db:"chain"`
-	CreatedAt    time.Time `db:"created_at"`
-	UpdatedAt    time.Time `db:"updated_at"`
+	ID          uuid.UUID `db:"id"`
+	Price       float64   `db:"price"`
+	TokenIn     string    `db:"token_in"`
+	AmountIn    float64   `db:"amount_in"`
+	TokenOut    string    `db:"token_out"`
+	AmountOut   float64   `db:"amount_out"`
+	Volume      float64   `db:"volume"`
+	Chain       string    `db:"chain"`
+	Pool        string    `db:"pool"`
+	BlockNumber int64     `db:"block_number"`
+	TxHash      string    `db:"tx_hash"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
 }
 
 func (e PriceTick) String() string {
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Swap is a trade indexed from a pool event. Amount0 and Amount1 are raw
+// token units paid into the pool, negative when paid out, and Volume0 and
+// Volume1 their absolute values normalized by the tokens' decimals.
+// AmountUSD is the value traded at the USD price known when the swap was
+// indexed, zero when neither token had one.
+type Swap struct {
+	ID          int64     `json:"-" db:"id"`
+	Chain       string    `json:"chain" db:"chain"`
+	Pool        string    `json:"pool" db:"pool"`
+	Dex         string    `json:"dex" db:"dex"`
+	Token0      string    `json:"token0" db:"token0"`
+	Token1      string    `json:"token1" db:"token1"`
+	Amount0     string    `json:"amount0" db:"amount0"`
+	Amount1     string    `json:"amount1" db:"amount1"`
+	Volume0     float64   `json:"volume0" db:"volume0"`
+	Volume1     float64   `json:"volume1" db:"volume1"`
+	AmountUSD   float64   `json:"amountUsd" db:"amount_usd"`
+	BlockNumber int64     `json:"blockNumber" db:"block_number"`
+	TxHash      string    `json:"txHash" db:"tx_hash"`
+	LogIndex    int       `json:"logIndex" db:"log_index"`
+	TradedAt    time.Time `json:"tradedAt" db:"traded_at"`
+}
+
+// String returns a JSON representation of Swap
+func (s Swap) String() string {
+	js, _ := json.Marshal(s)
+	return string(js)
+}
+
+// Swaps is a slice of Swap
+type Swaps []Swap
@@ -1,10 +1,11 @@
 #!/bin/bash
 
-echo "Starting main application..."
-go run cmd/main.go &
+# The chain listener runs inside the API process by default. To run it as a
+# separate service, start the API with LISTENER_MODE=subscribe and run
+# internal/script/listener alongside it.
 
-echo "Starting listener service..."
-go run internal/script/listener/main.go &
+echo "Starting main application..."
+go run cmd/app/main.go &
 
-echo "Both services started in the background."
-wait 
\ No newline at end of file
+echo "Application started in the background."
+wait